@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	dead_letter "go_link_storage/pkg/consumer/dead-letter"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// usage describes the subcommands accepted after the flags.
+const usage = `usage: bot [flags] [command]
+
+Without a command the bot is started. Commands:
+  dead-letters list          list events that failed processing
+  dead-letters replay <id>   process the event again right away
+  dead-letters purge [<id>]  delete the event, or every event`
+
+// runCommand runs the subcommand named by args and writes its output to w.
+func runCommand(ctx context.Context, w io.Writer, deadLetters *dead_letter.Queue, args []string) error {
+	if len(args) < 2 || args[0] != "dead-letters" {
+		return errors.New(usage)
+	}
+
+	switch cmd, rest := args[1], args[2:]; {
+	case cmd == "list" && len(rest) == 0:
+		return listDeadLetters(ctx, w, deadLetters)
+	case cmd == "replay" && len(rest) == 1:
+		if err := deadLetters.Replay(ctx, rest[0]); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintf(w, "dead letter %s processed\n", rest[0])
+
+		return err
+	case cmd == "purge" && len(rest) <= 1:
+		var id string
+		if len(rest) == 1 {
+			id = rest[0]
+		}
+
+		n, err := deadLetters.Purge(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "%d dead letters purged\n", n)
+
+		return err
+	default:
+		return errors.New(usage)
+	}
+}
+
+// listDeadLetters writes a table of the stored dead letters to w.
+func listDeadLetters(ctx context.Context, w io.Writer, deadLetters *dead_letter.Queue) error {
+	all, err := deadLetters.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "ID\tFAILED AT\tATTEMPTS\tNEXT ATTEMPT\tEVENT\tERROR")
+
+	for _, d := range all {
+		text := "<undecodable>"
+		if evt, err := dead_letter.Decode(d.Payload); err == nil {
+			text = evt.Text
+		}
+
+		next := "manual"
+		if !d.NextAttemptAt.IsZero() {
+			next = d.NextAttemptAt.Local().Format(time.DateTime)
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%q\t%s\n",
+			d.ID, d.FailedAt.Local().Format(time.DateTime), d.Attempts, next, text, d.Error)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,205 @@
+// Command bot runs the link storage Telegram bot.
+// It wires together a Telegram transport, a storage backend, the event processor
+// and the event consumer based on the settings loaded by package config.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/clients/tg_custom_client"
+	"go_link_storage/pkg/clients/tg_negasus_client"
+	"go_link_storage/pkg/config"
+	dead_letter "go_link_storage/pkg/consumer/dead-letter"
+	event_consumer "go_link_storage/pkg/consumer/event-consumer"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/events/tg_custom_fetcher"
+	"go_link_storage/pkg/events/tg_negasus_fetcher"
+	"go_link_storage/pkg/events/tg_processor"
+	"go_link_storage/pkg/events/tg_webhook_fetcher"
+	"go_link_storage/pkg/preview"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"go_link_storage/pkg/storage/postgres"
+	"go_link_storage/pkg/storage/sqlite"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// previewQueueSize is the number of saved pages waiting for their previews.
+const previewQueueSize = 100
+
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.SetLogLoggerLevel(cfg.SlogLevel())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		stop()
+		log.Fatal(err)
+	}
+
+	if len(cfg.Args) == 0 {
+		log.Print("service stopped")
+	}
+}
+
+// run starts the bot and blocks until ctx is canceled and the shutdown completes.
+// If cfg has arguments, the subcommand they name is run instead.
+func run(ctx context.Context, cfg config.Config) (err error) {
+	s, err := newStorage(ctx, cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("cannot init storage: %w", err)
+	}
+
+	if c, ok := s.(io.Closer); ok {
+		defer func() {
+			if closeErr := c.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("cannot close storage: %w", closeErr))
+			}
+		}()
+	}
+
+	client, fetcher, err := newTransport(cfg, s)
+	if err != nil {
+		return fmt.Errorf("cannot init telegram transport: %w", err)
+	}
+
+	var (
+		previews tg_processor.Previewer
+		wg       sync.WaitGroup
+	)
+
+	// Preview workers stop before the storage is closed, also when run fails.
+	previewCtx, cancel := context.WithCancel(ctx)
+	defer wg.Wait()
+	defer cancel()
+
+	if cfg.Preview.Workers > 0 && len(cfg.Args) == 0 {
+		q := preview.NewQueue(preview.New(cfg.Preview.Timeout, 0), s, cfg.Preview.Workers, previewQueueSize)
+		wg.Go(func() { q.Run(previewCtx) })
+		previews = q
+	}
+
+	// Dead letters only hold events meant for this bot, so subcommands
+	// do not need to ask Telegram for the bot's username.
+	var botName string
+
+	if len(cfg.Args) == 0 {
+		if botName, err = client.BotUsername(ctx); err != nil {
+			return err
+		}
+	}
+
+	processor := tg_processor.New(client, s, previews, botName)
+	deadLetters := dead_letter.New(s, processor)
+
+	if len(cfg.Args) > 0 {
+		return runCommand(ctx, os.Stdout, deadLetters, cfg.Args)
+	}
+
+	if err := processor.PublishCommands(ctx); err != nil {
+		log.Printf("[WARN] %s", err)
+	}
+
+	log.Printf("service started: transport=%s storage=%s", cfg.Telegram.Transport, cfg.Storage.Kind)
+
+	consumer := event_consumer.New(fetcher, processor, event_consumer.Config{
+		BatchSize:    cfg.Telegram.BatchSize,
+		Workers:      cfg.Consumer.Workers,
+		QueueSize:    cfg.Consumer.QueueSize,
+		DrainTimeout: cfg.ShutdownTimeout,
+		DeadLetters:  deadLetters,
+	})
+	if err := consumer.Start(ctx); err != nil {
+		return fmt.Errorf("consumer stopped: %w", err)
+	}
+
+	return nil
+}
+
+// backend is a storage that also keeps the update offset and failed events.
+type backend interface {
+	storage.Storage
+	storage.OffsetStore
+	storage.DeadLetterStore
+}
+
+// newStorage creates the storage backend selected in the config.
+// Backends are initialized before being returned: SQL backends get their
+// schema migrated and every backend brings older data up to date.
+func newStorage(ctx context.Context, cfg config.Storage) (backend, error) {
+	switch cfg.Kind {
+	case config.StorageSQLite:
+		s, err := sqlite.New(cfg.SQLite.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.Init(ctx); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	case config.StoragePostgres:
+		s, err := postgres.New(cfg.Postgres.DSN())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.Init(ctx); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	case config.StorageFiles:
+		s := files.New(cfg.Files.BasePath)
+
+		if err := s.Init(ctx); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Kind)
+	}
+}
+
+// newTransport creates the Telegram client and the matching event fetcher
+// for the transport selected in the config. Fetchers that poll for updates
+// keep their position in offsets.
+func newTransport(cfg config.Config, offsets storage.OffsetStore) (events.Client, events.Fetcher, error) {
+	switch cfg.Telegram.Transport {
+	case config.TransportCustom:
+		client := tg_custom_client.New(cfg.Telegram.Host, cfg.Telegram.Token)
+
+		return client, tg_custom_fetcher.New(client, offsets), nil
+	case config.TransportNegasus:
+		client := tg_negasus_client.New(cfg.Telegram.Token)
+
+		return client, tg_negasus_fetcher.New(client, cfg.SlogLevel() <= slog.LevelDebug), nil
+	case config.TransportWebhook:
+		client := tg_custom_client.New(cfg.Telegram.Host, cfg.Telegram.Token)
+
+		return client, tg_webhook_fetcher.New(client, tg_webhook_fetcher.Config{
+			URL:             cfg.Telegram.Webhook.URL,
+			ListenAddr:      cfg.Telegram.Webhook.ListenAddr,
+			Path:            cfg.Telegram.Webhook.Path,
+			Secret:          cfg.Telegram.Webhook.Secret,
+			ShutdownTimeout: cfg.ShutdownTimeout,
+		}), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown transport %q", cfg.Telegram.Transport)
+	}
+}
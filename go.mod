@@ -3,9 +3,12 @@ module go_link_storage
 go 1.25.6
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/go-telegram/bot v1.18.0
 	github.com/lib/pq v1.10.9
 	github.com/obalunenko/getenv v1.14.1
+	golang.org/x/net v0.46.0
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.44.3
 )
 
@@ -17,6 +20,7 @@ require (
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546 // indirect
 	golang.org/x/sys v0.37.0 // indirect
+	golang.org/x/text v0.30.0 // indirect
 	modernc.org/libc v1.67.6 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
@@ -0,0 +1,74 @@
+package tg_custom_client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// APIError is returned when the Bot API rejects a request.
+type APIError struct {
+	Method      string        // API method that failed
+	Code        int           // Telegram error_code, an HTTP status code
+	Description string        // Human-readable error description
+	RetryAfter  time.Duration // Time to wait before repeating the request after flood control
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("telegram api: %s: %d %s", e.Method, e.Code, e.Description)
+
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+
+	return msg
+}
+
+// Temporary reports whether repeating the request may succeed:
+// the server failed or the bot hit flood control.
+func (e *APIError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+}
+
+// IsAPIError reports whether err is an APIError with the given code.
+func IsAPIError(err error, code int) bool {
+	var apiErr *APIError
+
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// newAPIError builds an APIError from a response that is not ok.
+// Responses without a Telegram error body fall back to the HTTP status.
+func newAPIError(method string, status int, res BaseResponse) *APIError {
+	apiErr := &APIError{
+		Method:      method,
+		Code:        res.ErrorCode,
+		Description: res.Description,
+	}
+
+	if apiErr.Code == 0 {
+		apiErr.Code = status
+		apiErr.Description = http.StatusText(status)
+	}
+
+	if res.Parameters != nil {
+		apiErr.RetryAfter = time.Duration(res.Parameters.RetryAfter) * time.Second
+	}
+
+	return apiErr
+}
+
+// redactURL drops the request URL, which contains the bot token, from errors
+// of http.Client, so that they can be logged and stored.
+func redactURL(err error) error {
+	var urlErr *url.Error
+
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,109 @@
+package tg_custom_client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Telegram allows about 30 messages per second overall and about one
+// message per second in a single chat, with short bursts tolerated.
+const (
+	globalRate  = 30              // Messages per second to all chats
+	globalBurst = 30              // Messages sent at once to all chats
+	chatRate    = 1               // Messages per second to one chat
+	chatBurst   = 3               // Messages sent at once to one chat
+	maxIdleChat = 1 * time.Minute // Buckets idle for longer are dropped
+)
+
+// bucket is a token bucket: it holds up to burst tokens and refills rate tokens per second.
+type bucket struct {
+	rate   float64   // Tokens added per second
+	burst  float64   // Bucket capacity
+	tokens float64   // Tokens currently available
+	last   time.Time // Time tokens was last updated
+}
+
+// newBucket creates a full bucket.
+func newBucket(rate float64, burst float64, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using it.
+// The balance may go negative, so concurrent callers queue up behind each other.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limiter keeps outgoing messages within the global and per-chat limits.
+type limiter struct {
+	mu        sync.Mutex
+	global    *bucket         // Limit for all chats together
+	chats     map[int]*bucket // Limits of single chats
+	lastSweep time.Time       // Last time idle chats were dropped
+}
+
+// newLimiter creates a limiter with full buckets.
+func newLimiter() *limiter {
+	return &limiter{
+		global: newBucket(globalRate, globalBurst, time.Now()),
+		chats:  make(map[int]*bucket),
+	}
+}
+
+// wait blocks until a message may be sent to chatID or ctx is canceled.
+func (l *limiter) wait(ctx context.Context, chatID int) error {
+	d := l.reserve(chatID, time.Now())
+	if d == 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reserve takes a token from both buckets and returns the longer wait.
+func (l *limiter) reserve(chatID int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.dropIdle(now)
+
+	chat, ok := l.chats[chatID]
+	if !ok {
+		chat = newBucket(chatRate, chatBurst, now)
+		l.chats[chatID] = chat
+	}
+
+	return max(l.global.reserve(now), chat.reserve(now))
+}
+
+// dropIdle forgets chats that have not sent anything for a while;
+// their buckets would be full again anyway.
+func (l *limiter) dropIdle(now time.Time) {
+	if now.Sub(l.lastSweep) < maxIdleChat {
+		return
+	}
+	l.lastSweep = now
+
+	for id, b := range l.chats {
+		if now.Sub(b.last) > maxIdleChat {
+			delete(l.chats, id)
+		}
+	}
+}
@@ -2,33 +2,69 @@
 package tg_custom_client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"go_link_storage/pkg/events"
 	"go_link_storage/pkg/lib/e"
 	"io"
+	"log"
+	"math/rand/v2"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
+	"time"
 )
 
 // Client provides methods for interacting with the Telegram Bot API.
+// Failed requests are retried with backoff, and outgoing messages are
+// throttled to stay within Telegram's rate limits.
 type Client struct {
 	host     string      // Telegram API host
 	basePath string      // Base path for API requests (includes bot token)
 	client   http.Client // HTTP client for making requests
+	limiter  *limiter    // Rate limiter for outgoing messages
 }
 
 const (
-	getUpdatesMethod  = "getUpdates"  // API method for getting updates
-	sendMessageMethod = "sendMessage" // API method for sending messages
+	maxRetries   = 5                      // Retries of a failed request before giving up
+	baseBackoff  = 500 * time.Millisecond // Backoff before the first retry
+	maxBackoff   = 30 * time.Second       // Upper bound of the backoff
+	maxRetryWait = 5 * time.Minute        // Longest retry_after the client waits for
+
+	requestTimeout = 10 * time.Second // Time limit of a single request, on top of the long-poll timeout
+	uploadTimeout  = time.Minute      // Time limit of a single request uploading a file
 )
 
+const (
+	getUpdatesMethod      = "getUpdates"          // API method for getting updates
+	sendMessageMethod     = "sendMessage"         // API method for sending messages
+	editMessageTextMethod = "editMessageText"     // API method for editing sent messages
+	answerCallbackMethod  = "answerCallbackQuery" // API method for answering callback queries
+	setWebhookMethod      = "setWebhook"          // API method for registering a webhook
+	deleteWebhookMethod   = "deleteWebhook"       // API method for removing the webhook
+	setMyCommandsMethod   = "setMyCommands"       // API method for setting the command menu
+	sendDocumentMethod    = "sendDocument"        // API method for uploading files
+	getMeMethod           = "getMe"               // API method for getting the bot's own user
+)
+
+// upload is a file attached to a request.
+type upload struct {
+	field string // Name of the request parameter holding the file
+	name  string // File name
+	data  []byte // File contents
+}
+
 // New creates a new Telegram client with the given host and bot token.
 func New(host string, token string) *Client {
 	return &Client{
 		host:     host,
 		basePath: newBasePath(token),
 		client:   http.Client{},
+		limiter:  newLimiter(),
 	}
 }
 
@@ -37,16 +73,34 @@ func newBasePath(token string) string {
 	return "bot" + token
 }
 
+// UpdatesOptions tunes how Updates waits for and filters updates.
+// The zero value makes a short poll that returns every update type.
+type UpdatesOptions struct {
+	Timeout        time.Duration // Long-poll timeout: how long Telegram holds the request when there are no updates
+	AllowedUpdates []string      // Update types to receive, e.g. "message"; empty keeps the previous setting
+}
+
 // Updates fetches updates from the Telegram Bot API.
 // offset specifies the update ID to start from, limit specifies the maximum number of updates.
-func (c *Client) Updates(offset int, limit int) (updates []Update, err error) {
+// With a non-zero opts.Timeout the request blocks until an update arrives or the timeout expires.
+func (c *Client) Updates(ctx context.Context, offset int, limit int, opts UpdatesOptions) (updates []Update, err error) {
 	defer func() { err = e.WrapIfErr("can't get updates", err) }()
 
 	q := url.Values{}
 	q.Add("offset", strconv.Itoa(offset))
 	q.Add("limit", strconv.Itoa(limit))
+	q.Add("timeout", strconv.Itoa(int(opts.Timeout/time.Second)))
+
+	if len(opts.AllowedUpdates) > 0 {
+		allowed, err := json.Marshal(opts.AllowedUpdates)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Add("allowed_updates", string(allowed))
+	}
 
-	data, err := c.doRequest(getUpdatesMethod, q)
+	data, err := c.doRequestTimeout(ctx, getUpdatesMethod, q, nil, opts.Timeout+requestTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -61,12 +115,16 @@ func (c *Client) Updates(offset int, limit int) (updates []Update, err error) {
 }
 
 // SendMessage sends a text message to the specified chat.
-func (c *Client) SendMessage(chatID int, text string) error {
+func (c *Client) SendMessage(ctx context.Context, chatID int, text string) error {
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return e.Wrap("can't send message", err)
+	}
+
 	q := url.Values{}
 	q.Add("chat_id", strconv.Itoa(chatID))
 	q.Add("text", text)
 
-	_, err := c.doRequest(sendMessageMethod, q)
+	_, err := c.doRequest(ctx, sendMessageMethod, q)
 	if err != nil {
 		return e.Wrap("can't send message", err)
 	}
@@ -74,29 +132,232 @@ func (c *Client) SendMessage(chatID int, text string) error {
 	return nil
 }
 
+// SendKeyboard sends a text message with an inline keyboard to the specified chat.
+func (c *Client) SendKeyboard(ctx context.Context, chatID int, text string, kb events.Keyboard) error {
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return e.Wrap("can't send message", err)
+	}
+
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("text", text)
+
+	if err := addReplyMarkup(q, kb); err != nil {
+		return e.Wrap("can't send message", err)
+	}
+
+	if _, err := c.doRequest(ctx, sendMessageMethod, q); err != nil {
+		return e.Wrap("can't send message", err)
+	}
+
+	return nil
+}
+
+// EditKeyboard replaces the text and inline keyboard of a message in the specified chat.
+func (c *Client) EditKeyboard(ctx context.Context, chatID int, messageID int, text string, kb events.Keyboard) error {
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return e.Wrap("can't edit message", err)
+	}
+
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+	q.Add("message_id", strconv.Itoa(messageID))
+	q.Add("text", text)
+
+	if err := addReplyMarkup(q, kb); err != nil {
+		return e.Wrap("can't edit message", err)
+	}
+
+	if _, err := c.doRequest(ctx, editMessageTextMethod, q); err != nil {
+		return e.Wrap("can't edit message", err)
+	}
+
+	return nil
+}
+
+// AnswerCallbackQuery acknowledges a callback query, showing text as a notification if it is not empty.
+func (c *Client) AnswerCallbackQuery(ctx context.Context, queryID string, text string) error {
+	q := url.Values{}
+	q.Add("callback_query_id", queryID)
+
+	if text != "" {
+		q.Add("text", text)
+	}
+
+	if _, err := c.doRequest(ctx, answerCallbackMethod, q); err != nil {
+		return e.Wrap("can't answer callback query", err)
+	}
+
+	return nil
+}
+
+// SetWebhook makes Telegram deliver updates to webhookURL instead of getUpdates.
+// Telegram sends secretToken back in the X-Telegram-Bot-Api-Secret-Token header.
+func (c *Client) SetWebhook(ctx context.Context, webhookURL string, secretToken string) error {
+	q := url.Values{}
+	q.Add("url", webhookURL)
+	q.Add("secret_token", secretToken)
+
+	if _, err := c.doRequest(ctx, setWebhookMethod, q); err != nil {
+		return e.Wrap("can't set webhook", err)
+	}
+
+	return nil
+}
+
+// DeleteWebhook removes the webhook so updates can be fetched with getUpdates again.
+func (c *Client) DeleteWebhook(ctx context.Context) error {
+	if _, err := c.doRequest(ctx, deleteWebhookMethod, url.Values{}); err != nil {
+		return e.Wrap("can't delete webhook", err)
+	}
+
+	return nil
+}
+
+// SetCommands replaces the command menu Telegram clients show for the bot.
+func (c *Client) SetCommands(ctx context.Context, commands []events.Command) error {
+	list := make([]BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		list = append(list, BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return e.Wrap("can't set commands", err)
+	}
+
+	q := url.Values{}
+	q.Add("commands", string(data))
+
+	if _, err := c.doRequest(ctx, setMyCommandsMethod, q); err != nil {
+		return e.Wrap("can't set commands", err)
+	}
+
+	return nil
+}
+
+// BotUsername returns the username of the bot, as reported by getMe.
+func (c *Client) BotUsername(ctx context.Context) (username string, err error) {
+	defer func() { err = e.WrapIfErr("can't get bot username", err) }()
+
+	data, err := c.doRequest(ctx, getMeMethod, url.Values{})
+	if err != nil {
+		return "", err
+	}
+
+	var res MeResponse
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", err
+	}
+
+	return res.Result.Username, nil
+}
+
+// SendDocument uploads a file to the specified chat as multipart form data.
+func (c *Client) SendDocument(ctx context.Context, chatID int, doc events.Document) error {
+	if err := c.limiter.wait(ctx, chatID); err != nil {
+		return e.Wrap("can't send document", err)
+	}
+
+	q := url.Values{}
+	q.Add("chat_id", strconv.Itoa(chatID))
+
+	if doc.Caption != "" {
+		q.Add("caption", doc.Caption)
+	}
+
+	file := &upload{field: "document", name: doc.Name, data: doc.Data}
+
+	if _, err := c.doRequestTimeout(ctx, sendDocumentMethod, q, file, uploadTimeout); err != nil {
+		return e.Wrap("can't send document", err)
+	}
+
+	return nil
+}
+
+// addReplyMarkup encodes kb as the reply_markup parameter.
+// An empty keyboard still produces markup, so editing removes old buttons.
+func addReplyMarkup(q url.Values, kb events.Keyboard) error {
+	markup := InlineKeyboardMarkup{InlineKeyboard: make([][]InlineKeyboardButton, 0, len(kb))}
+
+	for _, row := range kb {
+		buttons := make([]InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, InlineKeyboardButton{Text: b.Text, CallbackData: b.Data})
+		}
+
+		markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+	}
+
+	data, err := json.Marshal(markup)
+	if err != nil {
+		return err
+	}
+
+	q.Add("reply_markup", string(data))
+
+	return nil
+}
+
 // doRequest performs an HTTP GET request to the Telegram Bot API.
 // method specifies the API method, query contains the request parameters.
-func (c *Client) doRequest(method string, query url.Values) (data []byte, err error) {
+func (c *Client) doRequest(ctx context.Context, method string, query url.Values) ([]byte, error) {
+	return c.doRequestTimeout(ctx, method, query, nil, requestTimeout)
+}
+
+// doRequestTimeout performs a request like doRequest, giving every attempt timeout to complete.
+// If file is not nil, it is uploaded along with query in a multipart POST request.
+// Network errors and server errors are retried with exponential backoff and jitter;
+// flood control errors are retried after the delay Telegram asks for.
+func (c *Client) doRequestTimeout(ctx context.Context, method string, query url.Values, file *upload, timeout time.Duration) (data []byte, err error) {
 	const errMsg = "couldn't do request"
 
 	defer func() { err = e.WrapIfErr(errMsg, err) }()
 
+	for attempt := 0; ; attempt++ {
+		data, err = c.doRequestOnce(ctx, method, query, file, timeout)
+		if err == nil || ctx.Err() != nil || attempt == maxRetries {
+			return data, err
+		}
+
+		delay, ok := retryDelay(err, attempt)
+		if !ok {
+			return nil, err
+		}
+
+		log.Printf("[WARN] telegram: %s failed, retrying in %s: %s", method, delay, err)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
+}
+
+// doRequestOnce performs a single request and returns the response body.
+// Responses that are not ok are returned as *APIError.
+func (c *Client) doRequestOnce(ctx context.Context, method string, query url.Values, file *upload, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	u := url.URL{
 		Scheme: "https",
 		Host:   c.host,
 		Path:   path.Join(c.basePath, method),
 	}
 
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	req, err := newRequest(ctx, u.String(), query, file)
 	if err != nil {
-		return nil, err
+		return nil, redactURL(err)
 	}
 
-	req.URL.RawQuery = query.Encode()
-
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, redactURL(err)
 	}
 
 	defer func() { _ = resp.Body.Close() }()
@@ -106,5 +367,90 @@ func (c *Client) doRequest(method string, query url.Values) (data []byte, err er
 		return nil, err
 	}
 
+	var res BaseResponse
+
+	if err := json.Unmarshal(body, &res); err != nil || !res.Ok {
+		return nil, newAPIError(method, resp.StatusCode, res)
+	}
+
 	return body, nil
 }
+
+// newRequest builds a GET request with query in the URL, or a multipart POST
+// request with query as form fields if there is a file to upload.
+// The body is built anew for every attempt, since a sent body is consumed.
+func newRequest(ctx context.Context, u string, query url.Values, file *upload) (*http.Request, error) {
+	if file == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.URL.RawQuery = query.Encode()
+
+		return req, nil
+	}
+
+	var body bytes.Buffer
+
+	w := multipart.NewWriter(&body)
+
+	for key, values := range query {
+		for _, v := range values {
+			if err := w.WriteField(key, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	part, err := w.CreateFormFile(file.field, file.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := part.Write(file.data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	return req, nil
+}
+
+// retryDelay returns how long to wait before repeating a request that failed
+// with err on the given zero-based attempt, and whether it should be repeated at all.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var apiErr *APIError
+
+	if !errors.As(err, &apiErr) {
+		// Network error: the request may not have reached Telegram.
+		return backoff(attempt), true
+	}
+
+	switch {
+	case !apiErr.Temporary():
+		return 0, false
+	case apiErr.RetryAfter > maxRetryWait:
+		return 0, false
+	case apiErr.RetryAfter > 0:
+		return apiErr.RetryAfter, true
+	default:
+		return backoff(attempt), true
+	}
+}
+
+// backoff returns a random delay up to baseBackoff*2^attempt, capped at maxBackoff.
+func backoff(attempt int) time.Duration {
+	d := min(maxBackoff, baseBackoff<<attempt)
+
+	return time.Duration(rand.Int64N(int64(d))) + 1
+}
@@ -0,0 +1,312 @@
+package tg_custom_client
+
+import (
+	"bytes"
+	"context"
+	"go_link_storage/pkg/events"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// response is a reply of the test server.
+type response struct {
+	status int    // HTTP status code
+	body   string // Response body
+}
+
+// newTestClient creates a client that talks to a TLS test server replying with responses in turn.
+// The last response is repeated once the list is exhausted.
+func newTestClient(t *testing.T, responses ...response) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		resp := responses[min(n, len(responses)-1)]
+
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := New(strings.TrimPrefix(srv.URL, "https://"), "token")
+	c.client = *srv.Client()
+
+	return c, &calls
+}
+
+func TestDoRequestRetries(t *testing.T) {
+	ok := response{http.StatusOK, `{"ok":true,"result":true}`}
+
+	tests := []struct {
+		name      string
+		responses []response
+		wantCode  int
+		wantCalls int32
+	}{
+		{
+			name:      "success",
+			responses: []response{ok},
+			wantCalls: 1,
+		},
+		{
+			name: "server error is retried",
+			responses: []response{
+				{http.StatusBadGateway, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`},
+				ok,
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "non-json server error is retried",
+			responses: []response{
+				{http.StatusBadGateway, `<html><body><h1>502 Bad Gateway</h1></body></html>`},
+				ok,
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "flood control is retried",
+			responses: []response{
+				{http.StatusTooManyRequests, `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":1}}`},
+				ok,
+			},
+			wantCalls: 2,
+		},
+		{
+			name:      "client error is not retried",
+			responses: []response{{http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`}},
+			wantCode:  http.StatusBadRequest,
+			wantCalls: 1,
+		},
+		{
+			name:      "non-json client error is not retried",
+			responses: []response{{http.StatusNotFound, `<html><body>404 Not Found</body></html>`}},
+			wantCode:  http.StatusNotFound,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, calls := newTestClient(t, tt.responses...)
+
+			err := c.SendMessage(context.Background(), 1, "hi")
+
+			switch {
+			case tt.wantCode == 0 && err != nil:
+				t.Fatalf("SendMessage() error = %v", err)
+			case tt.wantCode != 0 && !IsAPIError(err, tt.wantCode):
+				t.Fatalf("SendMessage() error = %v, want API error %d", err, tt.wantCode)
+			}
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("requests = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoRequestNonJSONServerError(t *testing.T) {
+	c, calls := newTestClient(t, response{http.StatusBadGateway, `<html><body><h1>502 Bad Gateway</h1></body></html>`})
+
+	// The first retry starts within baseBackoff; the deadline hits while waiting for a later one.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*baseBackoff)
+	defer cancel()
+
+	err := c.SendMessage(ctx, 1, "hi")
+	if !IsAPIError(err, http.StatusBadGateway) {
+		t.Fatalf("SendMessage() error = %v, want API error 502", err)
+	}
+
+	if got := calls.Load(); got < 2 {
+		t.Errorf("requests = %d, want the request retried", got)
+	}
+}
+
+func TestDoRequestStopsOnCancel(t *testing.T) {
+	c, calls := newTestClient(t, response{http.StatusInternalServerError, `{"ok":false,"error_code":500,"description":"Internal Server Error"}`})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := c.DeleteWebhook(ctx); err == nil {
+		t.Fatal("DeleteWebhook() error = nil, want error")
+	}
+
+	if got := calls.Load(); got > 2 {
+		t.Errorf("requests = %d, want at most 2", got)
+	}
+}
+
+func TestUpdatesLongPoll(t *testing.T) {
+	var query url.Values
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+
+		// Like Telegram, hold the request for the whole poll timeout when there are no updates.
+		timeout, _ := strconv.Atoi(query.Get("timeout"))
+		time.Sleep(time.Duration(timeout) * time.Second)
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":[{"update_id":7}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(strings.TrimPrefix(srv.URL, "https://"), "token")
+	c.client = *srv.Client()
+
+	opts := UpdatesOptions{Timeout: time.Second, AllowedUpdates: []string{"message", "callback_query"}}
+
+	updates, err := c.Updates(context.Background(), 5, 100, opts)
+	if err != nil {
+		t.Fatalf("Updates() error = %v, want the request to outlive the poll timeout", err)
+	}
+
+	if len(updates) != 1 || updates[0].ID != 7 {
+		t.Errorf("Updates() = %+v, want update 7", updates)
+	}
+
+	if got := query.Get("timeout"); got != "1" {
+		t.Errorf("timeout = %q, want 1", got)
+	}
+
+	if got := query.Get("allowed_updates"); got != `["message","callback_query"]` {
+		t.Errorf("allowed_updates = %q, want %q", got, `["message","callback_query"]`)
+	}
+
+	if got := query.Get("offset"); got != "5" {
+		t.Errorf("offset = %q, want 5", got)
+	}
+}
+
+func TestDoRequestHidesToken(t *testing.T) {
+	const token = "123456:secret-token"
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	host := strings.TrimPrefix(srv.URL, "https://")
+	srv.Close()
+
+	var logs bytes.Buffer
+
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	c := New(host, token)
+
+	// Leave time for a retry, so the retry warning is logged too.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*baseBackoff)
+	defer cancel()
+
+	err := c.SendMessage(ctx, 1, "hi")
+	if err == nil {
+		t.Fatal("SendMessage() error = nil, want network error")
+	}
+
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("error %q contains the bot token", err)
+	}
+
+	if !strings.Contains(logs.String(), "retrying") {
+		t.Errorf("logs = %q, want a retry warning", logs.String())
+	}
+
+	if strings.Contains(logs.String(), token) {
+		t.Errorf("logs %q contain the bot token", logs.String())
+	}
+}
+
+func TestSendDocument(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails, so the retry has to send the whole body again.
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":502,"description":"Bad Gateway"}`))
+			return
+		}
+
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/"+sendDocumentMethod) {
+			t.Errorf("request = %s %s, want POST .../%s", r.Method, r.URL.Path, sendDocumentMethod)
+		}
+
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Errorf("FormFile: %v", err)
+			return
+		}
+		defer func() { _ = file.Close() }()
+
+		data, _ := io.ReadAll(file)
+
+		if header.Filename != "links.csv" || string(data) != "url\n" {
+			t.Errorf("document = %q with %q, want links.csv with %q", header.Filename, data, "url\n")
+		}
+
+		if got := r.FormValue("chat_id"); got != "42" {
+			t.Errorf("chat_id = %q, want 42", got)
+		}
+
+		if got := r.FormValue("caption"); got != "Export" {
+			t.Errorf("caption = %q, want Export", got)
+		}
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer srv.Close()
+
+	c := New(strings.TrimPrefix(srv.URL, "https://"), "token")
+	c.client = *srv.Client()
+
+	doc := events.Document{Name: "links.csv", Data: []byte("url\n"), Caption: "Export"}
+	if err := c.SendDocument(context.Background(), 42, doc); err != nil {
+		t.Fatalf("SendDocument() error = %v", err)
+	}
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestBotUsername(t *testing.T) {
+	c, _ := newTestClient(t, response{http.StatusOK, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"MyLinkBot"}}`})
+
+	got, err := c.BotUsername(context.Background())
+	if err != nil {
+		t.Fatalf("BotUsername() error = %v", err)
+	}
+
+	if got != "MyLinkBot" {
+		t.Errorf("BotUsername() = %q, want MyLinkBot", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter()
+	now := time.Now()
+
+	for i := range chatBurst {
+		if d := l.reserve(1, now); d != 0 {
+			t.Fatalf("message %d waits %s within burst", i, d)
+		}
+	}
+
+	if d := l.reserve(1, now); d != time.Second/chatRate {
+		t.Errorf("message after burst waits %s, want %s", d, time.Second/chatRate)
+	}
+
+	if d := l.reserve(2, now); d != 0 {
+		t.Errorf("message to another chat waits %s, want 0", d)
+	}
+}
@@ -2,7 +2,15 @@ package tg_custom_client
 
 // BaseResponse represents the base structure of Telegram API responses.
 type BaseResponse struct {
-	Ok bool `json:"ok"` // Indicates if the API request was successful
+	Ok          bool                `json:"ok"`          // Indicates if the API request was successful
+	ErrorCode   int                 `json:"error_code"`  // Error code if the request failed
+	Description string              `json:"description"` // Error description if the request failed
+	Parameters  *ResponseParameters `json:"parameters"`  // Details helping to handle the error automatically
+}
+
+// ResponseParameters describes why a request was unsuccessful.
+type ResponseParameters struct {
+	RetryAfter int `json:"retry_after"` // Seconds to wait after exceeding flood control
 }
 
 // UpdatesResponse represents the response from the getUpdates API method.
@@ -11,25 +19,86 @@ type UpdatesResponse struct {
 	Result []Update `json:"result"` // List of updates
 }
 
+// MeResponse represents the response from the getMe API method.
+type MeResponse struct {
+	BaseResponse
+	Result From `json:"result"` // The bot itself
+}
+
 // From represents the sender information in a Telegram message.
 type From struct {
-	Username string `json:"username"` // Telegram username
+	ID        int64  `json:"id"`         // Unique user ID, unlike the username it never changes
+	Username  string `json:"username"`   // Telegram username
+	FirstName string `json:"first_name"` // User's first name
+	LastName  string `json:"last_name"`  // User's last name, may be empty
 }
 
 // Chat represents a Telegram chat.
 type Chat struct {
-	ID int `json:"id"` // Chat ID
+	ID       int    `json:"id"`       // Chat ID
+	Title    string `json:"title"`    // Title of a channel or group
+	Username string `json:"username"` // Public username of the chat, may be empty
 }
 
 // IncomingMessage represents an incoming Telegram message.
 type IncomingMessage struct {
-	Text string `json:"text"` // Message text content
-	From From   `json:"from"` // Sender information
-	Chat Chat   `json:"chat"` // Chat information
+	ID              int             `json:"message_id"`       // Message identifier inside the chat
+	Text            string          `json:"text"`             // Message text content
+	Entities        []MessageEntity `json:"entities"`         // Special parts of the text, such as links
+	Caption         string          `json:"caption"`          // Caption of a photo, video or document
+	CaptionEntities []MessageEntity `json:"caption_entities"` // Special parts of the caption
+	ForwardOrigin   *MessageOrigin  `json:"forward_origin"`   // Original sender of a forwarded message
+	From            From            `json:"from"`             // Sender information
+	Chat            Chat            `json:"chat"`             // Chat information
+}
+
+// MessageOrigin describes where a forwarded message was originally sent.
+// Which fields are set depends on Type.
+type MessageOrigin struct {
+	Type           string `json:"type"`             // "user", "hidden_user", "chat" or "channel"
+	SenderUser     *From  `json:"sender_user"`      // Original sender of a "user" origin
+	SenderUserName string `json:"sender_user_name"` // Name of the original sender of a "hidden_user" origin
+	SenderChat     *Chat  `json:"sender_chat"`      // Chat that sent a "chat" origin message
+	Chat           *Chat  `json:"chat"`             // Channel of a "channel" origin message
+	MessageID      int    `json:"message_id"`       // Message ID in the channel of a "channel" origin
+}
+
+// MessageEntity represents a special part of a message text, such as a link or a hashtag.
+type MessageEntity struct {
+	Type   string `json:"type"`   // Entity type, e.g. "url" or "text_link"
+	Offset int    `json:"offset"` // Start of the entity in UTF-16 code units
+	Length int    `json:"length"` // Length of the entity in UTF-16 code units
+	URL    string `json:"url"`    // Target of a text_link entity
+}
+
+// CallbackQuery represents a press of an inline keyboard button.
+type CallbackQuery struct {
+	ID      string           `json:"id"`      // Unique query identifier
+	From    From             `json:"from"`    // User who pressed the button
+	Message *IncomingMessage `json:"message"` // Message the button was attached to (nil for inline messages)
+	Data    string           `json:"data"`    // Callback data of the button
 }
 
 // Update represents a Telegram update from the Bot API.
 type Update struct {
-	ID      int              `json:"update_id"` // Unique update identifier
-	Message *IncomingMessage `json:"message"`   // Incoming message (nil if not a message update)
+	ID            int              `json:"update_id"`      // Unique update identifier
+	Message       *IncomingMessage `json:"message"`        // Incoming message (nil if not a message update)
+	CallbackQuery *CallbackQuery   `json:"callback_query"` // Button press (nil if not a callback query update)
+}
+
+// InlineKeyboardMarkup represents an inline keyboard attached to a message.
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"` // Rows of buttons
+}
+
+// InlineKeyboardButton represents a single inline keyboard button.
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`          // Button label
+	CallbackData string `json:"callback_data"` // Data sent back in the callback query
+}
+
+// BotCommand represents an entry of the bot's command menu.
+type BotCommand struct {
+	Command     string `json:"command"`     // Command name without the leading slash
+	Description string `json:"description"` // Description shown in the menu
 }
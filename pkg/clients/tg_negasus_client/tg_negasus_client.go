@@ -1,45 +1,217 @@
 package tg_negasus_client
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"go_link_storage/pkg/events"
 	"go_link_storage/pkg/lib/e"
-	"os"
-	"os/signal"
+	"net/url"
+	"sync"
+	"sync/atomic"
 
 	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
 )
 
 // Client provides methods for interacting with the Telegram Bot API.
+// The bot receiving updates is created by the fetcher when it starts and
+// handed over with SetBot; requests made before that, such as setting the
+// command menu, go through a bot that handles no updates.
 type Client struct {
-	Bot   *bot.Bot
-	Ctx   context.Context
 	Token string
+
+	receiver atomic.Pointer[bot.Bot] // Bot receiving updates, set by the fetcher
+
+	once   sync.Once // Guards creation of sender
+	sender *bot.Bot  // Bot used until the fetcher sets receiver
+	err    error     // Error creating sender
 }
 
-// New creates a new Telegram client with the given bot token and options.
+// New creates a new Telegram client with the given bot token.
 func New(token string) *Client {
-	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt)
-
 	return &Client{
-		Ctx:   ctx,
 		Token: token,
 	}
 }
 
+// redactURL drops the request URL, which contains the bot token, from errors
+// of the library's HTTP requests, so that they can be logged and stored.
+// The library formats the URL into its own message, so only the cause is kept.
+func redactURL(err error) error {
+	var urlErr *url.Error
+
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
+
 // newBasePath constructs the base path for API requests using the bot token.
 func newBasePath(token string) string {
 	return "bot" + token
 }
 
+// SetBot makes the client send requests through b, the bot receiving updates.
+// It is safe to call while other requests are being made.
+func (c *Client) SetBot(b *bot.Bot) {
+	c.receiver.Store(b)
+}
+
+// api returns the bot to make requests with.
+func (c *Client) api() (*bot.Bot, error) {
+	if b := c.receiver.Load(); b != nil {
+		return b, nil
+	}
+
+	c.once.Do(func() {
+		c.sender, c.err = bot.New(c.Token, bot.WithSkipGetMe())
+	})
+
+	return c.sender, c.err
+}
+
 // SendMessage sends a text message to the specified chat.
-func (c *Client) SendMessage(chatID int, text string) error {
-	_, err := c.Bot.SendMessage(c.Ctx, &bot.SendMessageParams{
+func (c *Client) SendMessage(ctx context.Context, chatID int, text string) error {
+	b, err := c.api()
+	if err != nil {
+		return e.Wrap("can't send message", err)
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: chatID,
 		Text:   text,
 	})
+	if err != nil {
+		return e.Wrap("can't send message", redactURL(err))
+	}
+
+	return nil
+}
+
+// SendKeyboard sends a text message with an inline keyboard to the specified chat.
+func (c *Client) SendKeyboard(ctx context.Context, chatID int, text string, kb events.Keyboard) error {
+	b, err := c.api()
 	if err != nil {
 		return e.Wrap("can't send message", err)
 	}
 
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ReplyMarkup: replyMarkup(kb),
+	})
+	if err != nil {
+		return e.Wrap("can't send message", redactURL(err))
+	}
+
+	return nil
+}
+
+// EditKeyboard replaces the text and inline keyboard of a message in the specified chat.
+func (c *Client) EditKeyboard(ctx context.Context, chatID int, messageID int, text string, kb events.Keyboard) error {
+	b, err := c.api()
+	if err != nil {
+		return e.Wrap("can't edit message", err)
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   messageID,
+		Text:        text,
+		ReplyMarkup: replyMarkup(kb),
+	})
+	if err != nil {
+		return e.Wrap("can't edit message", redactURL(err))
+	}
+
+	return nil
+}
+
+// AnswerCallbackQuery acknowledges a callback query, showing text as a notification if it is not empty.
+func (c *Client) AnswerCallbackQuery(ctx context.Context, queryID string, text string) error {
+	b, err := c.api()
+	if err != nil {
+		return e.Wrap("can't answer callback query", err)
+	}
+
+	_, err = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: queryID,
+		Text:            text,
+	})
+	if err != nil {
+		return e.Wrap("can't answer callback query", redactURL(err))
+	}
+
+	return nil
+}
+
+// SetCommands replaces the command menu Telegram clients show for the bot.
+func (c *Client) SetCommands(ctx context.Context, commands []events.Command) error {
+	b, err := c.api()
+	if err != nil {
+		return e.Wrap("can't set commands", err)
+	}
+
+	list := make([]models.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		list = append(list, models.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+
+	if _, err := b.SetMyCommands(ctx, &bot.SetMyCommandsParams{Commands: list}); err != nil {
+		return e.Wrap("can't set commands", redactURL(err))
+	}
+
+	return nil
+}
+
+// SendDocument uploads a file to the specified chat.
+func (c *Client) SendDocument(ctx context.Context, chatID int, doc events.Document) error {
+	b, err := c.api()
+	if err != nil {
+		return e.Wrap("can't send document", err)
+	}
+
+	_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: doc.Name, Data: bytes.NewReader(doc.Data)},
+		Caption:  doc.Caption,
+	})
+	if err != nil {
+		return e.Wrap("can't send document", redactURL(err))
+	}
+
 	return nil
 }
+
+// BotUsername returns the username of the bot, as reported by getMe.
+func (c *Client) BotUsername(ctx context.Context) (string, error) {
+	b, err := c.api()
+	if err != nil {
+		return "", e.Wrap("can't get bot username", err)
+	}
+
+	me, err := b.GetMe(ctx)
+	if err != nil {
+		return "", e.Wrap("can't get bot username", redactURL(err))
+	}
+
+	return me.Username, nil
+}
+
+// replyMarkup converts kb to the library's inline keyboard markup.
+func replyMarkup(kb events.Keyboard) *models.InlineKeyboardMarkup {
+	markup := &models.InlineKeyboardMarkup{InlineKeyboard: make([][]models.InlineKeyboardButton, 0, len(kb))}
+
+	for _, row := range kb {
+		buttons := make([]models.InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			buttons = append(buttons, models.InlineKeyboardButton{Text: b.Text, CallbackData: b.Data})
+		}
+
+		markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+	}
+
+	return markup
+}
@@ -0,0 +1,39 @@
+package tg_negasus_client
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/go-telegram/bot"
+)
+
+func TestSetBotWhileSending(t *testing.T) {
+	const token = "123456:token"
+
+	c := New(token)
+
+	b, err := bot.New(token, bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("bot.New: %v", err)
+	}
+
+	// The fetcher hands over its bot while the dead letter queue is already sending.
+	var wg sync.WaitGroup
+
+	wg.Go(func() { c.SetBot(b) })
+
+	if _, err := c.api(); err != nil {
+		t.Errorf("api() before SetBot error = %v", err)
+	}
+
+	wg.Wait()
+
+	got, err := c.api()
+	if err != nil {
+		t.Fatalf("api() error = %v", err)
+	}
+
+	if got != b {
+		t.Error("api() after SetBot does not return the bot receiving updates")
+	}
+}
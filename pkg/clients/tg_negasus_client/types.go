@@ -13,6 +13,7 @@ type UpdatesResponse struct {
 
 // From represents the sender information in a Telegram message.
 type From struct {
+	ID       int64  `json:"id"`       // Unique user ID, unlike the username it never changes
 	Username string `json:"username"` // Telegram username
 }
 
@@ -0,0 +1,442 @@
+// Package config loads and validates the bot configuration.
+// Settings are read from environment variables, an optional YAML or TOML
+// file and command line flags; each later source overrides the earlier ones.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/obalunenko/getenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TransportCustom  = "custom"  // Hand-written long-polling client
+	TransportNegasus = "negasus" // Client based on github.com/go-telegram/bot
+	TransportWebhook = "webhook" // Updates pushed by Telegram to an HTTP server
+
+	StorageFiles    = "files"    // File-based storage
+	StorageSQLite   = "sqlite"   // SQLite storage
+	StoragePostgres = "postgres" // PostgreSQL storage
+)
+
+// maxBatchSize is the largest number of updates Telegram returns per request.
+const maxBatchSize = 100
+
+// Config holds every setting required to start the bot.
+type Config struct {
+	Telegram        Telegram      `yaml:"telegram" toml:"telegram"`                 // Telegram transport settings
+	Storage         Storage       `yaml:"storage" toml:"storage"`                   // Storage backend settings
+	Consumer        Consumer      `yaml:"consumer" toml:"consumer"`                 // Event processing settings
+	Preview         Preview       `yaml:"preview" toml:"preview"`                   // Link preview settings
+	LogLevel        string        `yaml:"log_level" toml:"log_level"`               // Minimal log level: debug, info, warn or error
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // Time allowed to finish in-flight events on shutdown
+
+	Args []string `yaml:"-" toml:"-"` // Arguments left after the flags: a subcommand and its arguments
+}
+
+// Telegram holds the Telegram transport settings.
+type Telegram struct {
+	Token     string  `yaml:"token" toml:"token"`           // Bot token
+	Host      string  `yaml:"host" toml:"host"`             // Bot API host
+	Transport string  `yaml:"transport" toml:"transport"`   // Transport implementation: custom, negasus or webhook
+	BatchSize int     `yaml:"batch_size" toml:"batch_size"` // Number of updates fetched per request
+	Webhook   Webhook `yaml:"webhook" toml:"webhook"`       // Webhook transport settings
+}
+
+// Webhook holds the webhook transport settings.
+type Webhook struct {
+	URL        string `yaml:"url" toml:"url"`                 // Public HTTPS URL Telegram posts updates to
+	ListenAddr string `yaml:"listen_addr" toml:"listen_addr"` // Local address of the HTTP server
+	Path       string `yaml:"path" toml:"path"`               // Request path updates are accepted on
+	Secret     string `yaml:"secret" toml:"secret"`           // Secret token Telegram sends with every update
+}
+
+// Consumer holds the event processing settings.
+type Consumer struct {
+	Workers   int `yaml:"workers" toml:"workers"`       // Number of chats processed in parallel
+	QueueSize int `yaml:"queue_size" toml:"queue_size"` // Number of events waiting per worker
+}
+
+// Preview holds the link preview settings.
+type Preview struct {
+	Workers int           `yaml:"workers" toml:"workers"` // Number of pages fetched in parallel; 0 disables previews
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"` // Time limit of fetching a single page
+}
+
+// Storage holds the storage backend settings.
+type Storage struct {
+	Kind     string   `yaml:"kind" toml:"kind"`         // Backend: files, sqlite or postgres
+	Files    Files    `yaml:"files" toml:"files"`       // Files backend settings
+	SQLite   SQLite   `yaml:"sqlite" toml:"sqlite"`     // SQLite backend settings
+	Postgres Postgres `yaml:"postgres" toml:"postgres"` // PostgreSQL backend settings
+}
+
+// Files holds the files backend settings.
+type Files struct {
+	BasePath string `yaml:"base_path" toml:"base_path"` // Directory pages are stored in
+}
+
+// SQLite holds the SQLite backend settings.
+type SQLite struct {
+	Path string `yaml:"path" toml:"path"` // Database file path
+}
+
+// Postgres holds the PostgreSQL connection settings.
+type Postgres struct {
+	Host     string `yaml:"host" toml:"host"`         // Server host
+	Port     string `yaml:"port" toml:"port"`         // Server port
+	User     string `yaml:"user" toml:"user"`         // User name
+	Password string `yaml:"password" toml:"password"` // User password
+	DBName   string `yaml:"db_name" toml:"db_name"`   // Database name
+	SSLMode  string `yaml:"ssl_mode" toml:"ssl_mode"` // libpq sslmode value
+}
+
+// DSN builds a connection string for the lib/pq driver.
+func (p Postgres) DSN() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(p.User, p.Password),
+		Host:     net.JoinHostPort(p.Host, p.Port),
+		Path:     "/" + p.DBName,
+		RawQuery: url.Values{"sslmode": {p.SSLMode}}.Encode(),
+	}
+
+	return u.String()
+}
+
+// SlogLevel returns LogLevel as a slog.Level.
+// It must only be called on a validated config.
+func (c Config) SlogLevel() slog.Level {
+	var l slog.Level
+
+	_ = l.UnmarshalText([]byte(c.LogLevel))
+
+	return l
+}
+
+// Default returns the configuration used when no source overrides a setting.
+func Default() Config {
+	return Config{
+		Telegram: Telegram{
+			Host:      "api.telegram.org",
+			Transport: TransportCustom,
+			BatchSize: maxBatchSize,
+			Webhook: Webhook{
+				ListenAddr: ":8080",
+				Path:       "/webhook",
+			},
+		},
+		Storage: Storage{
+			Kind:   StoragePostgres,
+			Files:  Files{BasePath: "files_storage"},
+			SQLite: SQLite{Path: "data/sqlite/storage.db"},
+			Postgres: Postgres{
+				Host:    "localhost",
+				Port:    "5432",
+				User:    "postgres",
+				DBName:  "go_link_storage",
+				SSLMode: "disable",
+			},
+		},
+		Consumer: Consumer{
+			Workers:   4,
+			QueueSize: maxBatchSize,
+		},
+		Preview: Preview{
+			Workers: 2,
+			Timeout: 10 * time.Second,
+		},
+		LogLevel:        "info",
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+// Load builds the configuration from environment variables, the YAML or TOML
+// file named by the -config flag or CONFIG_FILE variable, and args.
+// args must not include the program name.
+// All validation problems are reported together in the returned error.
+func Load(args []string) (Config, error) {
+	// The first pass only discovers the config file and rejects malformed flags.
+	var (
+		scratch  Config
+		filePath string
+	)
+
+	pre := newFlagSet(&scratch, &filePath)
+	if err := pre.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+
+	errs := loadEnv(&cfg)
+
+	if filePath == "" {
+		filePath = os.Getenv("CONFIG_FILE")
+	}
+
+	if filePath != "" {
+		if err := loadFile(&cfg, filePath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	fs := newFlagSet(&cfg, &filePath)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Args = fs.Args()
+
+	errs = append(errs, cfg.validate()...)
+
+	if len(errs) > 0 {
+		return Config{}, fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	return cfg, nil
+}
+
+// newFlagSet registers every setting as a flag bound to cfg.
+func newFlagSet(cfg *Config, filePath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("bot", flag.ContinueOnError)
+
+	fs.StringVar(filePath, "config", *filePath, "path to YAML or TOML config file")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug, info, warn or error")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "time allowed to finish in-flight events on shutdown")
+
+	fs.StringVar(&cfg.Telegram.Token, "tg-bot-token", cfg.Telegram.Token, "token for access to telegram bot")
+	fs.StringVar(&cfg.Telegram.Host, "tg-host", cfg.Telegram.Host, "telegram api host")
+	fs.StringVar(&cfg.Telegram.Transport, "transport", cfg.Telegram.Transport, "telegram transport: custom, negasus or webhook")
+	fs.IntVar(&cfg.Telegram.BatchSize, "batch-size", cfg.Telegram.BatchSize, "number of updates fetched per request")
+	fs.StringVar(&cfg.Telegram.Webhook.URL, "webhook-url", cfg.Telegram.Webhook.URL, "public https url of the webhook")
+	fs.StringVar(&cfg.Telegram.Webhook.ListenAddr, "webhook-listen-addr", cfg.Telegram.Webhook.ListenAddr, "local address of the webhook server")
+	fs.StringVar(&cfg.Telegram.Webhook.Path, "webhook-path", cfg.Telegram.Webhook.Path, "request path of the webhook")
+	fs.StringVar(&cfg.Telegram.Webhook.Secret, "webhook-secret", cfg.Telegram.Webhook.Secret, "secret token of the webhook")
+
+	fs.IntVar(&cfg.Consumer.Workers, "workers", cfg.Consumer.Workers, "number of chats processed in parallel")
+	fs.IntVar(&cfg.Consumer.QueueSize, "queue-size", cfg.Consumer.QueueSize, "number of events waiting per worker")
+
+	fs.IntVar(&cfg.Preview.Workers, "preview-workers", cfg.Preview.Workers, "number of link previews fetched in parallel, 0 disables them")
+	fs.DurationVar(&cfg.Preview.Timeout, "preview-timeout", cfg.Preview.Timeout, "time limit of fetching a link preview")
+
+	fs.StringVar(&cfg.Storage.Kind, "storage", cfg.Storage.Kind, "storage backend: files, sqlite or postgres")
+	fs.StringVar(&cfg.Storage.Files.BasePath, "files-path", cfg.Storage.Files.BasePath, "base directory for files storage")
+	fs.StringVar(&cfg.Storage.SQLite.Path, "sqlite-path", cfg.Storage.SQLite.Path, "database file for sqlite storage")
+
+	fs.StringVar(&cfg.Storage.Postgres.Host, "pg-host", cfg.Storage.Postgres.Host, "postgres host")
+	fs.StringVar(&cfg.Storage.Postgres.Port, "pg-port", cfg.Storage.Postgres.Port, "postgres port")
+	fs.StringVar(&cfg.Storage.Postgres.User, "pg-user", cfg.Storage.Postgres.User, "postgres user")
+	fs.StringVar(&cfg.Storage.Postgres.Password, "pg-password", cfg.Storage.Postgres.Password, "postgres password")
+	fs.StringVar(&cfg.Storage.Postgres.DBName, "pg-db", cfg.Storage.Postgres.DBName, "postgres database name")
+	fs.StringVar(&cfg.Storage.Postgres.SSLMode, "pg-sslmode", cfg.Storage.Postgres.SSLMode, "postgres sslmode")
+
+	return fs
+}
+
+// loadEnv overrides cfg with the environment variables that are set.
+// It returns an error for every variable that cannot be parsed.
+func loadEnv(cfg *Config) []error {
+	var errs []error
+
+	envVar(&errs, "LOG_LEVEL", &cfg.LogLevel)
+	envVar(&errs, "SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+
+	envVar(&errs, "TELEGRAM_BOT_TOKEN", &cfg.Telegram.Token)
+	envVar(&errs, "TELEGRAM_HOST", &cfg.Telegram.Host)
+	envVar(&errs, "TELEGRAM_TRANSPORT", &cfg.Telegram.Transport)
+	envVar(&errs, "TELEGRAM_BATCH_SIZE", &cfg.Telegram.BatchSize)
+	envVar(&errs, "TELEGRAM_WEBHOOK_URL", &cfg.Telegram.Webhook.URL)
+	envVar(&errs, "TELEGRAM_WEBHOOK_LISTEN_ADDR", &cfg.Telegram.Webhook.ListenAddr)
+	envVar(&errs, "TELEGRAM_WEBHOOK_PATH", &cfg.Telegram.Webhook.Path)
+	envVar(&errs, "TELEGRAM_WEBHOOK_SECRET", &cfg.Telegram.Webhook.Secret)
+
+	envVar(&errs, "CONSUMER_WORKERS", &cfg.Consumer.Workers)
+	envVar(&errs, "CONSUMER_QUEUE_SIZE", &cfg.Consumer.QueueSize)
+
+	envVar(&errs, "PREVIEW_WORKERS", &cfg.Preview.Workers)
+	envVar(&errs, "PREVIEW_TIMEOUT", &cfg.Preview.Timeout)
+
+	envVar(&errs, "STORAGE_KIND", &cfg.Storage.Kind)
+	envVar(&errs, "FILES_STORAGE_PATH", &cfg.Storage.Files.BasePath)
+	envVar(&errs, "SQLITE_PATH", &cfg.Storage.SQLite.Path)
+
+	envVar(&errs, "POSTGRES_HOST", &cfg.Storage.Postgres.Host)
+	envVar(&errs, "POSTGRES_PORT", &cfg.Storage.Postgres.Port)
+	envVar(&errs, "POSTGRES_USER", &cfg.Storage.Postgres.User)
+	envVar(&errs, "POSTGRES_PASSWORD", &cfg.Storage.Postgres.Password)
+	envVar(&errs, "POSTGRES_DB", &cfg.Storage.Postgres.DBName)
+	envVar(&errs, "POSTGRES_SSLMODE", &cfg.Storage.Postgres.SSLMode)
+
+	return errs
+}
+
+// envVar stores the environment variable named by key into dst if it is set.
+// Parse failures are appended to errs.
+func envVar[T string | int | time.Duration](errs *[]error, key string, dst *T) {
+	v, err := getenv.Env[T](key)
+
+	switch {
+	case errors.Is(err, getenv.ErrNotSet):
+		return
+	case err != nil:
+		*errs = append(*errs, err)
+	default:
+		*dst = v
+	}
+}
+
+// loadFile overrides cfg with the settings present in the file at path.
+// The format is chosen by the extension: .yaml or .yml for YAML, .toml for TOML.
+func loadFile(cfg *Config, path string) error {
+	var unmarshal func([]byte, any) error
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return fmt.Errorf("unsupported config file format %q: use .yaml, .yml or .toml", ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	if err := unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// validate returns every problem found in the config.
+func (c Config) validate() []error {
+	var errs []error
+
+	if c.Telegram.Token == "" {
+		errs = append(errs, errors.New("telegram bot token is not specified: set TELEGRAM_BOT_TOKEN or -tg-bot-token"))
+	}
+
+	if c.Telegram.Host == "" {
+		errs = append(errs, errors.New("telegram host is empty"))
+	}
+
+	switch c.Telegram.Transport {
+	case TransportCustom, TransportNegasus:
+	case TransportWebhook:
+		errs = append(errs, c.Telegram.Webhook.validate()...)
+	default:
+		errs = append(errs, fmt.Errorf("unknown telegram transport %q", c.Telegram.Transport))
+	}
+
+	if c.Telegram.BatchSize < 1 || c.Telegram.BatchSize > maxBatchSize {
+		errs = append(errs, fmt.Errorf("batch size must be between 1 and %d, got %d", maxBatchSize, c.Telegram.BatchSize))
+	}
+
+	if c.Consumer.Workers < 1 {
+		errs = append(errs, fmt.Errorf("number of workers must be positive, got %d", c.Consumer.Workers))
+	}
+
+	if c.Consumer.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("queue size must be positive, got %d", c.Consumer.QueueSize))
+	}
+
+	if c.Preview.Workers < 0 {
+		errs = append(errs, fmt.Errorf("number of preview workers must not be negative, got %d", c.Preview.Workers))
+	}
+
+	if c.Preview.Workers > 0 && c.Preview.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("preview timeout must be positive, got %s", c.Preview.Timeout))
+	}
+
+	switch c.Storage.Kind {
+	case StorageFiles:
+		if c.Storage.Files.BasePath == "" {
+			errs = append(errs, errors.New("files storage path is empty"))
+		}
+	case StorageSQLite:
+		if c.Storage.SQLite.Path == "" {
+			errs = append(errs, errors.New("sqlite path is empty"))
+		}
+	case StoragePostgres:
+		errs = append(errs, c.Storage.Postgres.validate()...)
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage kind %q", c.Storage.Kind))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout must be positive, got %s", c.ShutdownTimeout))
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q", c.LogLevel))
+	}
+
+	return errs
+}
+
+// secretRe matches the secret tokens accepted by Telegram's setWebhook.
+var secretRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// validate returns every problem found in the webhook settings.
+func (w Webhook) validate() []error {
+	var errs []error
+
+	if u, err := url.Parse(w.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("webhook url must be an absolute https url, got %q", w.URL))
+	}
+
+	if w.ListenAddr == "" {
+		errs = append(errs, errors.New("webhook listen address is empty"))
+	}
+
+	if !strings.HasPrefix(w.Path, "/") {
+		errs = append(errs, fmt.Errorf("webhook path must start with /, got %q", w.Path))
+	}
+
+	if !secretRe.MatchString(w.Secret) {
+		errs = append(errs, errors.New("webhook secret must be 1-256 characters of A-Z, a-z, 0-9, _ and -"))
+	}
+
+	return errs
+}
+
+// validate returns every problem found in the PostgreSQL settings.
+func (p Postgres) validate() []error {
+	var errs []error
+
+	if p.Host == "" {
+		errs = append(errs, errors.New("postgres host is empty"))
+	}
+
+	if port, err := strconv.Atoi(p.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid postgres port %q", p.Port))
+	}
+
+	if p.User == "" {
+		errs = append(errs, errors.New("postgres user is empty"))
+	}
+
+	if p.DBName == "" {
+		errs = append(errs, errors.New("postgres database name is empty"))
+	}
+
+	return errs
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envKeys lists the variables Load reads.
+var envKeys = []string{
+	"CONFIG_FILE", "LOG_LEVEL", "SHUTDOWN_TIMEOUT",
+	"TELEGRAM_BOT_TOKEN", "TELEGRAM_HOST", "TELEGRAM_TRANSPORT", "TELEGRAM_BATCH_SIZE",
+	"TELEGRAM_WEBHOOK_URL", "TELEGRAM_WEBHOOK_LISTEN_ADDR", "TELEGRAM_WEBHOOK_PATH", "TELEGRAM_WEBHOOK_SECRET",
+	"CONSUMER_WORKERS", "CONSUMER_QUEUE_SIZE", "PREVIEW_WORKERS", "PREVIEW_TIMEOUT",
+	"STORAGE_KIND", "FILES_STORAGE_PATH", "SQLITE_PATH",
+	"POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB", "POSTGRES_SSLMODE",
+}
+
+// setEnv clears every variable Load reads and then sets env for the rest of the test.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	for key, v := range env {
+		t.Setenv(key, v)
+	}
+}
+
+// writeFile writes data to a file with the given name in a temporary directory and returns its path.
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const (
+		yamlFile = "telegram:\n  token: file-token\n  batch_size: 20\nconsumer:\n  workers: 2\nshutdown_timeout: 20s\n"
+		tomlFile = "shutdown_timeout = \"20s\"\n\n[telegram]\ntoken = \"file-token\"\nbatch_size = 20\n\n[consumer]\nworkers = 2\n"
+	)
+
+	env := map[string]string{
+		"TELEGRAM_BOT_TOKEN":  "env-token",
+		"TELEGRAM_BATCH_SIZE": "10",
+		"CONSUMER_WORKERS":    "1",
+		"SHUTDOWN_TIMEOUT":    "10s",
+		"STORAGE_KIND":        StorageSQLite,
+	}
+
+	tests := []struct {
+		name        string
+		file        string
+		data        string
+		args        []string
+		wantToken   string
+		wantBatch   int
+		wantWorkers int
+		wantTimeout time.Duration
+	}{
+		{
+			name:        "env only",
+			wantToken:   "env-token",
+			wantBatch:   10,
+			wantWorkers: 1,
+			wantTimeout: 10 * time.Second,
+		},
+		{
+			name:        "yaml file over env",
+			file:        "bot.yaml",
+			data:        yamlFile,
+			wantToken:   "file-token",
+			wantBatch:   20,
+			wantWorkers: 2,
+			wantTimeout: 20 * time.Second,
+		},
+		{
+			name:        "toml file over env",
+			file:        "bot.toml",
+			data:        tomlFile,
+			wantToken:   "file-token",
+			wantBatch:   20,
+			wantWorkers: 2,
+			wantTimeout: 20 * time.Second,
+		},
+		{
+			name:        "flags over yaml file and env",
+			file:        "bot.yml",
+			data:        yamlFile,
+			args:        []string{"-tg-bot-token", "flag-token", "-batch-size", "30", "-workers", "3", "-shutdown-timeout", "30s"},
+			wantToken:   "flag-token",
+			wantBatch:   30,
+			wantWorkers: 3,
+			wantTimeout: 30 * time.Second,
+		},
+		{
+			name:        "flags over toml file and env",
+			file:        "bot.toml",
+			data:        tomlFile,
+			args:        []string{"-tg-bot-token", "flag-token", "-batch-size", "30"},
+			wantToken:   "flag-token",
+			wantBatch:   30,
+			wantWorkers: 2,
+			wantTimeout: 20 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, env)
+
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file, tt.data)}, args...)
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if cfg.Telegram.Token != tt.wantToken {
+				t.Errorf("token = %q, want %q", cfg.Telegram.Token, tt.wantToken)
+			}
+
+			if cfg.Telegram.BatchSize != tt.wantBatch {
+				t.Errorf("batch size = %d, want %d", cfg.Telegram.BatchSize, tt.wantBatch)
+			}
+
+			if cfg.Consumer.Workers != tt.wantWorkers {
+				t.Errorf("workers = %d, want %d", cfg.Consumer.Workers, tt.wantWorkers)
+			}
+
+			if cfg.ShutdownTimeout != tt.wantTimeout {
+				t.Errorf("shutdown timeout = %s, want %s", cfg.ShutdownTimeout, tt.wantTimeout)
+			}
+
+			if cfg.Storage.Kind != StorageSQLite {
+				t.Errorf("storage kind = %q, want %q", cfg.Storage.Kind, StorageSQLite)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	setEnv(t, map[string]string{
+		"CONFIG_FILE": writeFile(t, "bot.yaml", "telegram:\n  token: file-token\n"),
+	})
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Telegram.Token != "file-token" {
+		t.Errorf("token = %q, want file-token", cfg.Telegram.Token)
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	setEnv(t, map[string]string{
+		"TELEGRAM_BATCH_SIZE": "many",
+		"LOG_LEVEL":           "loud",
+	})
+
+	path := writeFile(t, "bot.json", `{"telegram": {"token": "x"}}`)
+
+	_, err := Load([]string{"-config", path, "-workers", "0", "-storage", "memory", "-shutdown-timeout", "-1s"})
+	if err == nil {
+		t.Fatal("Load returned no error")
+	}
+
+	for _, want := range []string{
+		"TELEGRAM_BATCH_SIZE",
+		`unsupported config file format ".json"`,
+		"telegram bot token is not specified",
+		"number of workers must be positive, got 0",
+		`unknown storage kind "memory"`,
+		"shutdown timeout must be positive, got -1s",
+		`invalid log level "loud"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadFileErrorsJoined(t *testing.T) {
+	setEnv(t, nil)
+
+	path := writeFile(t, "bot.toml", "telegram = [")
+
+	_, err := Load([]string{"-config", path, "-batch-size", "0"})
+	if err == nil {
+		t.Fatal("Load returned no error")
+	}
+
+	for _, want := range []string{"cannot parse config file", "batch size must be between 1 and 100, got 0"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
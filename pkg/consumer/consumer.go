@@ -1,9 +1,12 @@
 // Package consumer defines the interface for event consumers.
 package consumer
 
+import "context"
+
 // Consumer defines the interface for consuming and processing events.
 type Consumer interface {
 	// Start begins consuming and processing events.
-	// It should run continuously until an error occurs or the consumer is stopped.
-	Start() error
+	// It runs until ctx is canceled or an unrecoverable error occurs,
+	// and returns nil after a graceful shutdown.
+	Start(ctx context.Context) error
 }
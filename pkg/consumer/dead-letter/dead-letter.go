@@ -0,0 +1,214 @@
+// Package dead_letter keeps events that failed processing in a storage.DeadLetterStore
+// and retries them with exponential backoff until they succeed or the attempts run out.
+package dead_letter
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/lib/e"
+	"go_link_storage/pkg/storage"
+	"log"
+	"time"
+)
+
+const (
+	maxAttempts   = 10               // Failed attempts after which an event is only replayed manually
+	baseDelay     = 1 * time.Minute  // Delay before the first retry
+	maxDelay      = 2 * time.Hour    // Upper bound of the delay between retries
+	retryInterval = 30 * time.Second // How often Run looks for due events
+	retryBatch    = 50               // Number of due events retried per round
+	maxListed     = 1000             // Number of events returned by List
+)
+
+// Queue stores failed events and processes them again later.
+type Queue struct {
+	store     storage.DeadLetterStore // Storage of failed events
+	processor events.Processor        // Processor the events are retried with
+}
+
+// New creates a dead letter queue that keeps events in store and retries them with processor.
+// Event metadata must be registered with gob.Register to be stored.
+func New(store storage.DeadLetterStore, processor events.Processor) *Queue {
+	return &Queue{
+		store:     store,
+		processor: processor,
+	}
+}
+
+// Add stores an event that failed processing with cause for a later retry.
+func (q *Queue) Add(ctx context.Context, evt events.Event, cause error) error {
+	payload, err := Encode(evt)
+	if err != nil {
+		return e.Wrap("cannot add dead letter", err)
+	}
+
+	now := time.Now().UTC()
+
+	d := &storage.DeadLetter{
+		Payload:       payload,
+		Error:         cause.Error(),
+		Attempts:      1,
+		FailedAt:      now,
+		NextAttemptAt: nextAttempt(1, now),
+	}
+
+	if err := q.store.AddDeadLetter(ctx, d); err != nil {
+		return e.Wrap("cannot add dead letter", err)
+	}
+
+	log.Printf("event stored as dead letter %s: %s", d.ID, cause)
+
+	return nil
+}
+
+// Run retries due events every retryInterval until ctx is canceled.
+func (q *Queue) Run(ctx context.Context) {
+	t := time.NewTicker(retryInterval)
+	defer t.Stop()
+
+	for {
+		if err := q.RetryDue(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			log.Printf("[ERR] dead letters: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RetryDue processes the events whose next attempt is due by now.
+// Failed events are rescheduled; errors of single events are only logged.
+func (q *Queue) RetryDue(ctx context.Context, now time.Time) error {
+	due, err := q.store.DeadLetters(ctx, now, retryBatch)
+	if err != nil {
+		return e.Wrap("cannot retry dead letters", err)
+	}
+
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := q.retry(ctx, d, now); err != nil {
+			log.Printf("[ERR] dead letters: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Replay processes the event with the given ID right away, even if its attempts ran out.
+// On success the event is removed; otherwise it is rescheduled and the processing error returned.
+func (q *Queue) Replay(ctx context.Context, id string) error {
+	d, err := q.store.DeadLetter(ctx, id)
+	if err != nil {
+		return e.Wrap("cannot replay dead letter", err)
+	}
+
+	return q.retry(ctx, d, time.Now().UTC())
+}
+
+// List returns the stored events, oldest first, up to maxListed of them.
+func (q *Queue) List(ctx context.Context) ([]*storage.DeadLetter, error) {
+	res, err := q.store.DeadLetters(ctx, time.Time{}, maxListed)
+	if err != nil {
+		return nil, e.Wrap("cannot list dead letters", err)
+	}
+
+	return res, nil
+}
+
+// Purge removes the event with the given ID, or every event if id is empty.
+// It returns the number of removed events.
+func (q *Queue) Purge(ctx context.Context, id string) (int, error) {
+	if id != "" {
+		if err := q.store.RemoveDeadLetter(ctx, id); err != nil {
+			return 0, e.Wrap("cannot purge dead letter", err)
+		}
+
+		return 1, nil
+	}
+
+	n := 0
+
+	for {
+		all, err := q.List(ctx)
+		if err != nil || len(all) == 0 {
+			return n, err
+		}
+
+		for _, d := range all {
+			err := q.store.RemoveDeadLetter(ctx, d.ID)
+			if err != nil && !errors.Is(err, storage.ErrDeadLetterNotFound) {
+				return n, e.Wrap("cannot purge dead letters", err)
+			}
+
+			if err == nil {
+				n++
+			}
+		}
+	}
+}
+
+// retry processes the stored event once, removing it on success and rescheduling it on failure.
+func (q *Queue) retry(ctx context.Context, d *storage.DeadLetter, now time.Time) (err error) {
+	defer func() { err = e.WrapIfErr("cannot retry dead letter "+d.ID, err) }()
+
+	evt, err := Decode(d.Payload)
+	if err != nil {
+		return err
+	}
+
+	procErr := q.processor.Process(ctx, evt)
+	if procErr == nil {
+		return q.store.RemoveDeadLetter(ctx, d.ID)
+	}
+
+	d.Attempts++
+	d.Error = procErr.Error()
+	d.NextAttemptAt = nextAttempt(d.Attempts, now)
+
+	if err := q.store.UpdateDeadLetter(ctx, d); err != nil {
+		return errors.Join(procErr, err)
+	}
+
+	return procErr
+}
+
+// nextAttempt returns when an event that failed attempts times is retried next,
+// or the zero time once the attempts ran out.
+func nextAttempt(attempts int, now time.Time) time.Time {
+	if attempts >= maxAttempts {
+		return time.Time{}
+	}
+
+	return now.Add(min(maxDelay, baseDelay<<(attempts-1)))
+}
+
+// Encode serializes an event with gob for storing it as a dead letter payload.
+func Encode(evt events.Event) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(evt); err != nil {
+		return nil, e.Wrap("cannot encode event", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode restores an event serialized with Encode.
+func Decode(payload []byte) (events.Event, error) {
+	var evt events.Event
+
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&evt); err != nil {
+		return events.Event{}, e.Wrap("cannot decode event", err)
+	}
+
+	return evt, nil
+}
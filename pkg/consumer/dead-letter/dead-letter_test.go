@@ -0,0 +1,103 @@
+package dead_letter
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/storage/files"
+	"testing"
+	"time"
+)
+
+// testMeta is event metadata stored in dead letters.
+type testMeta struct {
+	ChatID int
+}
+
+func init() {
+	gob.Register(testMeta{})
+}
+
+// flakyProcessor fails until it has been called failures times.
+type flakyProcessor struct {
+	failures int
+	calls    int
+	last     events.Event
+}
+
+func (p *flakyProcessor) Process(_ context.Context, evt events.Event) error {
+	p.calls++
+	p.last = evt
+
+	if p.calls <= p.failures {
+		return errors.New("storage unavailable")
+	}
+
+	return nil
+}
+
+func TestQueueRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	proc := &flakyProcessor{failures: 1}
+	q := New(files.New(t.TempDir()), proc)
+
+	evt := events.Event{Type: events.Message, Text: "https://example.com", Meta: testMeta{ChatID: 7}}
+
+	if err := q.Add(ctx, evt, errors.New("storage unavailable")); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	now := time.Now().UTC()
+
+	// Not due yet.
+	if err := q.RetryDue(ctx, now); err != nil {
+		t.Fatalf("RetryDue: %v", err)
+	}
+	if proc.calls != 0 {
+		t.Fatalf("event retried %d times before it was due", proc.calls)
+	}
+
+	// First retry fails and is rescheduled with a longer delay.
+	now = now.Add(baseDelay)
+	if err := q.RetryDue(ctx, now); err != nil {
+		t.Fatalf("RetryDue: %v", err)
+	}
+
+	all, err := q.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all) != 1 || all[0].Attempts != 2 || !all[0].NextAttemptAt.Equal(now.Add(2*baseDelay)) {
+		t.Fatalf("after failed retry got %+v, want one letter with 2 attempts due in %s", all, 2*baseDelay)
+	}
+
+	// Second retry succeeds and removes the event.
+	if err := q.RetryDue(ctx, now.Add(2*baseDelay)); err != nil {
+		t.Fatalf("RetryDue: %v", err)
+	}
+
+	if proc.last.Text != evt.Text || proc.last.Meta != evt.Meta {
+		t.Errorf("processed %+v, want %+v", proc.last, evt)
+	}
+
+	if all, _ := q.List(ctx); len(all) != 0 {
+		t.Errorf("%d dead letters left after a successful retry", len(all))
+	}
+}
+
+func TestNextAttempt(t *testing.T) {
+	now := time.Now()
+
+	if got := nextAttempt(1, now); !got.Equal(now.Add(baseDelay)) {
+		t.Errorf("nextAttempt(1) = %s, want %s", got, now.Add(baseDelay))
+	}
+
+	if got := nextAttempt(9, now); !got.Equal(now.Add(maxDelay)) {
+		t.Errorf("nextAttempt(9) = %s, want capped at %s", got, now.Add(maxDelay))
+	}
+
+	if got := nextAttempt(maxAttempts, now); !got.IsZero() {
+		t.Errorf("nextAttempt(%d) = %s, want zero", maxAttempts, got)
+	}
+}
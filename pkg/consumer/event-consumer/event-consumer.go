@@ -1,49 +1,75 @@
 // Package event_consumer provides an implementation of the consumer.Consumer interface.
-// It fetches events in batches and processes them continuously.
+// It fetches events in batches and processes them with a pool of workers.
 package event_consumer
 
 import (
+	"context"
+	"go_link_storage/pkg/consumer"
 	"go_link_storage/pkg/events"
-	"log"
+	"sync"
+	"time"
 )
 
+// Config holds the consumer settings.
+type Config struct {
+	BatchSize    int           // Number of events to fetch per batch
+	Workers      int           // Number of events processed in parallel
+	QueueSize    int           // Number of events waiting per worker before fetching blocks
+	DrainTimeout time.Duration // Time allowed to finish in-flight events on shutdown
+	DeadLetters  DeadLetters   // Keeps failed events for a retry; nil only logs them
+}
+
+// DeadLetters stores events that failed processing and retries them in the background.
+type DeadLetters interface {
+	// Add stores an event that failed processing with cause.
+	Add(ctx context.Context, evt events.Event, cause error) error
+	// Run retries stored events until ctx is canceled.
+	Run(ctx context.Context)
+}
+
 // Consumer implements the consumer.Consumer interface.
 // It fetches events from a Fetcher and processes them using a Processor.
 type Consumer struct {
 	fetcher   events.Fetcher   // Source of events to fetch
 	processor events.Processor // Processor for handling events
-	batchSize int              // Number of events to fetch per batch
+	cfg       Config           // Consumer settings
 }
 
-// New creates a new event consumer with the given fetcher, processor, and batch size.
+var _ consumer.Consumer = Consumer{}
+
+// New creates a new event consumer with the given fetcher, processor, and settings.
 func New(fetcher events.Fetcher,
 	processor events.Processor,
-	batchSize int) Consumer {
+	cfg Config) Consumer {
 
 	return Consumer{
 		fetcher:   fetcher,
 		processor: processor,
-		batchSize: batchSize,
+		cfg:       cfg,
 	}
 }
 
-// Start begins consuming events in a continuous loop.
-// It fetches events in batches and processes them, sleeping when no events are available.
-func (c Consumer) Start() {
-	c.fetcher.Start(c.handleEvents, c.batchSize)
-}
+// Start begins consuming events until ctx is canceled.
+// Canceling ctx stops fetching; events already fetched keep being processed
+// with a context that is canceled only once the drain timeout expires.
+func (c Consumer) Start(ctx context.Context) error {
+	procCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(c.cfg.DrainTimeout, cancel)
+	})
+	defer stop()
 
-// handleEvents processes a batch of events sequentially.
-func (c *Consumer) handleEvents(events []events.Event) error {
-	for _, event := range events {
-		log.Printf("new event: %s", event.Text)
+	p := newPool(procCtx, c.processor, c.cfg.DeadLetters, c.cfg.Workers, c.cfg.QueueSize)
+	defer p.stop()
 
-		if err := c.processor.Process(event); err != nil {
-			log.Printf("couldn't handle event: %s", err.Error())
+	if c.cfg.DeadLetters != nil {
+		var wg sync.WaitGroup
+		defer wg.Wait()
 
-			continue
-		}
+		wg.Go(func() { c.cfg.DeadLetters.Run(ctx) })
 	}
 
-	return nil
+	return c.fetcher.Start(ctx, p.handleEvents, c.cfg.BatchSize)
 }
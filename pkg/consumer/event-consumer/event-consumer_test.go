@@ -0,0 +1,141 @@
+package event_consumer
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/events"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFetcher hands out one batch of events and then waits for ctx to be canceled.
+type fakeFetcher struct {
+	batch   []events.Event
+	fetched chan struct{} // Closed once the batch is queued
+}
+
+func (f *fakeFetcher) Start(ctx context.Context, handleEventsCallback func([]events.Event) error, _ int) error {
+	if err := handleEventsCallback(f.batch); err != nil {
+		return err
+	}
+
+	close(f.fetched)
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// sleeper takes delay to process an event unless its context is canceled first.
+// It records the context error every event finished with.
+type sleeper struct {
+	delay   time.Duration
+	started chan string
+
+	mu       sync.Mutex
+	finished map[string]error
+	canceled time.Time // When the context of the last canceled event was canceled
+}
+
+func (s *sleeper) Process(ctx context.Context, evt events.Event) error {
+	s.started <- evt.Text
+
+	var err error
+
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.canceled = time.Now()
+	}
+
+	s.finished[evt.Text] = err
+
+	return nil
+}
+
+// startConsumer starts a consumer of a batch with two events in different chats
+// and cancels its context once both are being processed.
+// It returns when the consumer was canceled and the error Start returned.
+func startConsumer(t *testing.T, s *sleeper, drainTimeout time.Duration) (time.Time, error) {
+	t.Helper()
+
+	f := &fakeFetcher{
+		batch: []events.Event{
+			{Type: events.Message, Text: "a", Meta: chatMeta(1)},
+			{Type: events.Message, Text: "b", Meta: chatMeta(2)},
+		},
+		fetched: make(chan struct{}),
+	}
+
+	c := New(f, s, Config{BatchSize: 2, Workers: 2, QueueSize: 1, DrainTimeout: drainTimeout})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan error, 1)
+	go func() { started <- c.Start(ctx) }()
+
+	<-f.fetched
+	<-s.started
+	<-s.started
+
+	canceled := time.Now()
+	cancel()
+
+	select {
+	case err := <-started:
+		return canceled, err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after ctx was canceled")
+		return canceled, nil
+	}
+}
+
+func TestStartDrainsInFlightEvents(t *testing.T) {
+	s := &sleeper{delay: 100 * time.Millisecond, started: make(chan string, 2), finished: make(map[string]error)}
+
+	if _, err := startConsumer(t, s, 5*time.Second); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// Start returns only once the events fetched before the shutdown are processed.
+	for _, text := range []string{"a", "b"} {
+		err, ok := s.finished[text]
+
+		switch {
+		case !ok:
+			t.Errorf("event %q not finished when Start returned", text)
+		case err != nil:
+			t.Errorf("event %q was cut off with %v, want it to finish within the drain timeout", text, err)
+		}
+	}
+}
+
+func TestStartCancelsProcessingAfterDrainTimeout(t *testing.T) {
+	const drainTimeout = 100 * time.Millisecond
+
+	s := &sleeper{delay: time.Hour, started: make(chan string, 2), finished: make(map[string]error)}
+
+	canceled, err := startConsumer(t, s, drainTimeout)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	for _, text := range []string{"a", "b"} {
+		if err := s.finished[text]; !errors.Is(err, context.Canceled) {
+			t.Errorf("event %q finished with %v, want %v", text, err, context.Canceled)
+		}
+	}
+
+	if waited := s.canceled.Sub(canceled); waited < drainTimeout {
+		t.Errorf("processing canceled %v after shutdown, want at least the drain timeout (%v)", waited, drainTimeout)
+	}
+}
@@ -0,0 +1,128 @@
+package event_consumer
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/events"
+	"log"
+	"sync"
+)
+
+// errStopped is returned by handleEvents once the pool is stopped.
+var errStopped = errors.New("event consumer is stopped")
+
+// pool processes events on a fixed set of workers.
+// Events of one chat always go to the same worker, so they are processed
+// in order, while events of different chats are processed in parallel.
+type pool struct {
+	ctx         context.Context     // Context passed to the processor
+	processor   events.Processor    // Processor for handling events
+	deadLetters DeadLetters         // Receives failed events, may be nil
+	queues      []chan events.Event // Per-worker bounded queues
+	wg          sync.WaitGroup      // Running workers
+
+	mu      sync.RWMutex // Held for reading while a batch is queued and for writing by stop
+	stopped bool         // Whether stop has been called; guarded by mu
+}
+
+// newPool starts workers goroutines, each with a queue of queueSize events.
+// Failed events are passed to deadLetters unless it is nil.
+func newPool(ctx context.Context, processor events.Processor, deadLetters DeadLetters, workers int, queueSize int) *pool {
+	p := &pool{
+		ctx:         ctx,
+		processor:   processor,
+		deadLetters: deadLetters,
+		queues:      make([]chan events.Event, workers),
+	}
+
+	for i := range p.queues {
+		p.queues[i] = make(chan events.Event, queueSize)
+
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+
+	return p
+}
+
+// handleEvents distributes a batch between the workers and returns once
+// every event is queued, so a slow chat does not hold up the next batch.
+// The Done func of an event is called once it is processed; failed events
+// are handed to the dead letter queue first.
+// It blocks while the target worker's queue is full. Once the pool is
+// stopped it queues nothing and returns errStopped, so the batch is fetched again later.
+func (p *pool) handleEvents(events []events.Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// stop waits for the lock, so events are never sent to a closed queue.
+	if p.stopped {
+		return errStopped
+	}
+
+	for _, event := range events {
+		p.queues[p.shard(event)] <- event
+	}
+
+	return nil
+}
+
+// stop lets the workers finish queued events and waits for them to exit.
+// Batches being queued are queued completely first; later calls to
+// handleEvents return errStopped.
+func (p *pool) stop() {
+	p.mu.Lock()
+	p.stopped = true
+
+	for _, q := range p.queues {
+		close(q)
+	}
+
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// work processes events from the queue until it is closed.
+func (p *pool) work(queue <-chan events.Event) {
+	defer p.wg.Done()
+
+	for event := range queue {
+		log.Printf("new event: %s", event.Text)
+
+		if err := p.processor.Process(p.ctx, event); err != nil {
+			p.fail(event, err)
+		}
+
+		if event.Done != nil {
+			event.Done()
+		}
+	}
+}
+
+// fail logs a failed event and stores it as a dead letter.
+// Only messages are stored: callback queries expire within seconds,
+// so replaying them later would fail anyway.
+// Events cut off by the drain timeout fail with p.ctx canceled; they are
+// stored all the same, since their updates are not fetched again.
+func (p *pool) fail(event events.Event, err error) {
+	log.Printf("couldn't handle event: %s", err.Error())
+
+	if p.deadLetters == nil || event.Type != events.Message {
+		return
+	}
+
+	if err := p.deadLetters.Add(context.WithoutCancel(p.ctx), event, err); err != nil {
+		log.Printf("[ERR] event lost: %s", err)
+	}
+}
+
+// shard picks the worker for the event. Events without a chat go to the first worker.
+func (p *pool) shard(event events.Event) int {
+	m, ok := event.Meta.(events.ChatScoped)
+	if !ok {
+		return 0
+	}
+
+	return int(uint(m.ChatKey()) % uint(len(p.queues)))
+}
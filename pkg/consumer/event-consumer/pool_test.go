@@ -0,0 +1,265 @@
+package event_consumer
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/events"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chatMeta is event metadata that belongs to a chat.
+type chatMeta int
+
+func (m chatMeta) ChatKey() int { return int(m) }
+
+// recorder records the order events of every chat were processed in.
+type recorder struct {
+	mu   sync.Mutex
+	seen map[int][]string
+}
+
+func (r *recorder) Process(_ context.Context, evt events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	chat := int(evt.Meta.(chatMeta))
+	r.seen[chat] = append(r.seen[chat], evt.Text)
+
+	return nil
+}
+
+func TestPoolKeepsChatOrder(t *testing.T) {
+	r := &recorder{seen: make(map[int][]string)}
+
+	p := newPool(context.Background(), r, nil, 3, 2)
+
+	var (
+		batch []events.Event
+		want  = make(map[int][]string)
+	)
+
+	for i := 0; i < 20; i++ {
+		for _, chat := range []int{1, 2, -3, 4} {
+			text := string(rune('a' + i))
+			batch = append(batch, events.Event{Type: events.Message, Text: text, Meta: chatMeta(chat)})
+			want[chat] = append(want[chat], text)
+		}
+	}
+
+	if err := p.handleEvents(batch); err != nil {
+		t.Fatalf("handleEvents: %v", err)
+	}
+
+	// Every queued event is processed once stop returns.
+	p.stop()
+
+	for chat, texts := range want {
+		if !slices.Equal(r.seen[chat], texts) {
+			t.Errorf("chat %d processed %v, want %v", chat, r.seen[chat], texts)
+		}
+	}
+}
+
+// blocker processes events of the chats in blocked only once release is closed.
+// started and done receive the text of every event as its processing starts and ends.
+type blocker struct {
+	blocked map[int]bool
+	release chan struct{}
+	started chan string
+	done    chan string
+}
+
+func (b *blocker) Process(_ context.Context, evt events.Event) error {
+	b.started <- evt.Text
+
+	if b.blocked[int(evt.Meta.(chatMeta))] {
+		<-b.release
+	}
+
+	b.done <- evt.Text
+
+	return nil
+}
+
+// newBlocker creates a blocker holding the events of the given chats.
+func newBlocker(chats ...int) *blocker {
+	b := &blocker{
+		blocked: make(map[int]bool),
+		release: make(chan struct{}),
+		started: make(chan string, 10),
+		done:    make(chan string, 10),
+	}
+
+	for _, chat := range chats {
+		b.blocked[chat] = true
+	}
+
+	return b
+}
+
+func TestPoolSlowChatDoesNotBlockOthers(t *testing.T) {
+	b := newBlocker(2)
+
+	// With two workers chat 2 goes to the first one and chat 1 to the second.
+	p := newPool(context.Background(), b, nil, 2, 1)
+	defer p.stop()
+	defer close(b.release)
+
+	// handleEvents only queues the events, so the next batch is not held up by chat 2.
+	if err := p.handleEvents([]events.Event{{Type: events.Message, Text: "slow", Meta: chatMeta(2)}}); err != nil {
+		t.Fatalf("handleEvents: %v", err)
+	}
+
+	if err := p.handleEvents([]events.Event{{Type: events.Message, Text: "fast", Meta: chatMeta(1)}}); err != nil {
+		t.Fatalf("handleEvents: %v", err)
+	}
+
+	select {
+	case text := <-b.done:
+		if text != "fast" {
+			t.Fatalf("event %q finished first, want fast", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event of chat 1 did not finish while chat 2 was blocked")
+	}
+}
+
+// failer fails every event.
+type failer struct{}
+
+func (failer) Process(context.Context, events.Event) error {
+	return errors.New("storage is down")
+}
+
+// fakeDeadLetters records the events added to it.
+// Like a real store, it fails once ctx is canceled.
+type fakeDeadLetters struct {
+	mu    sync.Mutex
+	added []string
+}
+
+func (d *fakeDeadLetters) Add(ctx context.Context, evt events.Event, _ error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.added = append(d.added, evt.Text)
+
+	return nil
+}
+
+func (d *fakeDeadLetters) Run(context.Context) {}
+
+func TestPoolReportsDone(t *testing.T) {
+	dl := &fakeDeadLetters{}
+	p := newPool(context.Background(), failer{}, dl, 2, 4)
+
+	var (
+		mu   sync.Mutex
+		done []string
+	)
+
+	batch := []events.Event{
+		{Type: events.Message, Text: "a", Meta: chatMeta(1)},
+		{Type: events.Message, Text: "b", Meta: chatMeta(2)},
+		{Type: events.Message, Text: "c", Meta: chatMeta(1)},
+	}
+
+	for i := range batch {
+		text := batch[i].Text
+		batch[i].Done = func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// A failed event is stored as a dead letter before it is reported done.
+			dl.mu.Lock()
+			defer dl.mu.Unlock()
+
+			if !slices.Contains(dl.added, text) {
+				t.Errorf("event %q reported done before it was stored as a dead letter", text)
+			}
+
+			done = append(done, text)
+		}
+	}
+
+	if err := p.handleEvents(batch); err != nil {
+		t.Fatalf("handleEvents: %v", err)
+	}
+
+	p.stop()
+
+	slices.Sort(done)
+
+	if want := []string{"a", "b", "c"}; !slices.Equal(done, want) {
+		t.Errorf("done = %v, want %v", done, want)
+	}
+}
+
+func TestPoolStopWhileQueueing(t *testing.T) {
+	b := newBlocker(1)
+
+	// One worker with room for one event: the third event cannot be queued
+	// until the first one is processed.
+	p := newPool(context.Background(), b, nil, 1, 1)
+
+	batch := []events.Event{
+		{Type: events.Message, Text: "a", Meta: chatMeta(1)},
+		{Type: events.Message, Text: "b", Meta: chatMeta(1)},
+		{Type: events.Message, Text: "c", Meta: chatMeta(1)},
+	}
+
+	handled := make(chan error, 1)
+	go func() { handled <- p.handleEvents(batch) }()
+
+	<-b.started
+
+	stopped := make(chan struct{})
+	go func() {
+		p.stop()
+		close(stopped)
+	}()
+
+	// Give stop the chance to run while "c" is still waiting for the queue.
+	time.Sleep(50 * time.Millisecond)
+	close(b.release)
+
+	if err := <-handled; err != nil {
+		t.Fatalf("handleEvents: %v", err)
+	}
+
+	<-stopped
+
+	if got := len(b.started); got != 2 {
+		t.Errorf("%d more events processed, want the rest of the batch (2)", got)
+	}
+
+	if err := p.handleEvents(batch); !errors.Is(err, errStopped) {
+		t.Errorf("handleEvents after stop = %v, want %v", err, errStopped)
+	}
+}
+
+func TestPoolStoresEventsCutOffAtShutdown(t *testing.T) {
+	// The processor context is canceled once the drain timeout expires.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dl := &fakeDeadLetters{}
+	p := newPool(ctx, failer{}, dl, 1, 1)
+
+	if err := p.handleEvents([]events.Event{{Type: events.Message, Text: "a", Meta: chatMeta(1)}}); err != nil {
+		t.Fatalf("handleEvents: %v", err)
+	}
+
+	p.stop()
+
+	if want := []string{"a"}; !slices.Equal(dl.added, want) {
+		t.Errorf("dead letters = %v, want %v", dl.added, want)
+	}
+}
@@ -1,105 +1,279 @@
 package tg_custom_fetcher
 
 import (
+	"context"
 	"go_link_storage/pkg/clients/tg_custom_client"
 	"go_link_storage/pkg/events"
 	"go_link_storage/pkg/events/tg_processor"
 	"go_link_storage/pkg/lib/e"
+	"go_link_storage/pkg/storage"
 	"log"
+	"sync"
 	"time"
 )
 
+const (
+	retryDelay  = 1 * time.Second  // How long Start waits after a failed fetch
+	pollTimeout = 50 * time.Second // How long Telegram holds a getUpdates request without updates
+
+	offsetName = "telegram_updates" // Name of the stream in the offset store
+)
+
+// allowedUpdates lists the update types the processor handles.
+var allowedUpdates = []string{"message", "callback_query"}
+
+// updater fetches updates from the Telegram Bot API; *tg_custom_client.Client implements it.
+type updater interface {
+	Updates(ctx context.Context, offset int, limit int, opts tg_custom_client.UpdatesOptions) ([]tg_custom_client.Update, error)
+}
+
+// Fetcher polls the Telegram Bot API for updates using tg_custom_client.
+// Fetching does not wait for updates to be handled, so a slow chat does not
+// hold up the others. The offset of the oldest update that is not handled yet
+// is persisted in an OffsetStore. Telegram forgets updates once a later offset
+// is requested, so updates are delivered at least once across restarts only
+// because the consumer finishes the updates in flight, or stores them as dead
+// letters, before it stops.
 type Fetcher struct {
-	tg     *tg_custom_client.Client // Telegram API client
-	offset int                      // Offset for fetching updates
+	tg      updater             // Telegram API client
+	offsets storage.OffsetStore // Persistent store of the update offset
+	offset  int                 // ID of the first update that is not fetched yet
+	pending tracker             // Updates fetched but not committed yet
+
+	commitMu  sync.Mutex // Orders the writes of the offset
+	committed int        // Offset stored last; guarded by commitMu
 }
 
-// New creates a new Telegram event processor with the given client.
-func New(client *tg_custom_client.Client) *Fetcher {
+// New creates a new Telegram event fetcher with the given client and offset store.
+func New(client *tg_custom_client.Client, offsets storage.OffsetStore) *Fetcher {
 	return &Fetcher{
-		tg: client,
+		tg:      client,
+		offsets: offsets,
 	}
 }
 
-func (f *Fetcher) Start(handleEventsCallback func(events []events.Event) error, batchSize int) {
+// Start long-polls for updates in a loop and passes every non-empty batch to handleEventsCallback.
+// The offset of an update is committed once it and every update before it have been handled;
+// a batch handleEventsCallback fails to queue is fetched again.
+// It returns nil once ctx is canceled. Updates still being handled keep committing
+// the offset after Start returns, until the consumer has finished them.
+func (f *Fetcher) Start(ctx context.Context, handleEventsCallback func(events []events.Event) error, batchSize int) error {
+	offset, err := f.offsets.Offset(ctx, offsetName)
+	if err != nil {
+		return e.Wrap("cannot load offset", err)
+	}
+
+	f.offset = offset
+	f.committed = offset
+	f.pending.reset(offset)
+
 	for {
-		cEvents, err := f.Fetch(batchSize)
+		cEvents, next, err := f.Fetch(ctx, batchSize)
+		if ctx.Err() != nil {
+			return nil
+		}
+
 		if err != nil {
 			log.Printf("[ERR] consumer: %s", err)
+			sleep(ctx, retryDelay)
 
 			continue
 		}
 
-		if len(cEvents) == 0 {
-			time.Sleep(1 * time.Second)
+		if len(cEvents) > 0 {
+			if err := handleEventsCallback(cEvents); err != nil {
+				f.pending.drop(f.offset)
 
-			continue
+				log.Println(err)
+				sleep(ctx, retryDelay)
+
+				continue
+			}
 		}
 
-		if err := handleEventsCallback(cEvents); err != nil {
-			log.Println(err)
+		f.offset = next
+	}
+}
 
-			continue
-		}
+// handled marks the update as handled and commits the offset if it moved forward.
+func (f *Fetcher) handled(ctx context.Context, id int) {
+	if offset, ok := f.pending.finish(id); ok {
+		f.commit(ctx, offset)
 	}
 }
 
-// Fetch retrieves Telegram updates and converts them to events.
-// It updates the internal offset to track processed updates.
-func (f *Fetcher) Fetch(limit int) ([]events.Event, error) {
-	updates, err := f.tg.Updates(f.offset, limit)
-	if err != nil {
-		return nil, e.Wrap("cannot get events", err)
+// commit persists offset unless a later one is stored already.
+// A failed write is only logged: the updates have been handled already and
+// at worst are delivered again after a restart.
+func (f *Fetcher) commit(ctx context.Context, offset int) {
+	f.commitMu.Lock()
+	defer f.commitMu.Unlock()
+
+	if offset <= f.committed {
+		return
+	}
+
+	f.committed = offset
+
+	if err := f.offsets.SetOffset(context.WithoutCancel(ctx), offsetName, offset); err != nil {
+		log.Printf("[ERR] consumer: %s", e.Wrap("cannot save offset", err))
+	}
+}
+
+// Fetch retrieves Telegram updates starting at the current offset and converts them to events.
+// It returns the offset to fetch from next once the events are queued. Updates older than
+// the current offset are dropped, so a batch is never handled twice by one fetcher.
+// The returned updates are tracked until their events report through Done that they are handled.
+func (f *Fetcher) Fetch(ctx context.Context, limit int) ([]events.Event, int, error) {
+	opts := tg_custom_client.UpdatesOptions{
+		Timeout:        pollTimeout,
+		AllowedUpdates: allowedUpdates,
 	}
 
-	if len(updates) == 0 {
-		return nil, nil
+	updates, err := f.tg.Updates(ctx, f.offset, limit, opts)
+	if err != nil {
+		return nil, f.offset, e.Wrap("cannot get events", err)
 	}
 
+	next := f.offset
 	res := make([]events.Event, 0, len(updates))
+	ids := make([]int, 0, len(updates))
 
 	for _, u := range updates {
-		res = append(res, event(u))
+		if u.ID < next {
+			continue
+		}
+
+		id := u.ID
+		evt := Event(u)
+		evt.Done = func() { f.handled(ctx, id) }
+
+		res = append(res, evt)
+		ids = append(ids, id)
+		next = id + 1
 	}
 
-	f.offset = updates[len(updates)-1].ID + 1
+	f.pending.add(ids, next)
+
+	return res, next, nil
+}
+
+// sleep pauses for d or until ctx is canceled, whichever happens first.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
 
-	return res, nil
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
 }
 
-// event converts a Telegram update to an events.Event.
-func event(upd tg_custom_client.Update) events.Event {
+// Event converts a Telegram update to an events.Event.
+func Event(upd tg_custom_client.Update) events.Event {
 	updType := fetchType(upd)
 
 	res := events.Event{
-		Type: fetchType(upd),
+		Type: updType,
 		Text: fetchText(upd),
 	}
 
-	if updType == events.Message {
+	switch updType {
+	case events.Message:
 		res.Meta = tg_processor.Meta{
 			ChatID:   upd.Message.Chat.ID,
+			UserID:   upd.Message.From.ID,
 			Username: upd.Message.From.Username,
+			Entities: entities(upd.Message),
+			Source:   source(upd.Message.ForwardOrigin),
+		}
+	case events.CallbackQuery:
+		res.Meta = tg_processor.CallbackMeta{
+			QueryID:   upd.CallbackQuery.ID,
+			ChatID:    upd.CallbackQuery.Message.Chat.ID,
+			MessageID: upd.CallbackQuery.Message.ID,
+			UserID:    upd.CallbackQuery.From.ID,
+			Username:  upd.CallbackQuery.From.Username,
+			Data:      upd.CallbackQuery.Data,
 		}
 	}
 
 	return res
 }
 
+// entities converts the entities of the message text, or of the caption
+// for media messages, to the processor's representation.
+func entities(msg *tg_custom_client.IncomingMessage) []tg_processor.Entity {
+	ents := msg.Entities
+	if msg.Text == "" {
+		ents = msg.CaptionEntities
+	}
+
+	if len(ents) == 0 {
+		return nil
+	}
+
+	res := make([]tg_processor.Entity, 0, len(ents))
+
+	for _, ent := range ents {
+		res = append(res, tg_processor.Entity{
+			Type:   ent.Type,
+			Offset: ent.Offset,
+			Length: ent.Length,
+			URL:    ent.URL,
+		})
+	}
+
+	return res
+}
+
+// source describes where a forwarded message came from.
+// Messages that were not forwarded have the zero Source.
+func source(origin *tg_custom_client.MessageOrigin) tg_processor.Source {
+	if origin == nil {
+		return tg_processor.Source{}
+	}
+
+	switch {
+	case origin.Type == "channel" && origin.Chat != nil:
+		c := origin.Chat
+		return tg_processor.ChannelSource(int64(c.ID), c.Title, c.Username, origin.MessageID)
+	case origin.Type == "chat" && origin.SenderChat != nil:
+		return tg_processor.ChatSource(origin.SenderChat.Title, origin.SenderChat.Username)
+	case origin.Type == "user" && origin.SenderUser != nil:
+		u := origin.SenderUser
+		return tg_processor.UserSource(u.FirstName, u.LastName, u.Username)
+	case origin.Type == "hidden_user":
+		return tg_processor.Source{Name: origin.SenderUserName}
+	default:
+		return tg_processor.Source{}
+	}
+}
+
 // fetchText extracts the text content from a Telegram update.
+// Media messages have no text, so their caption is used instead.
 func fetchText(upd tg_custom_client.Update) string {
-	if upd.Message == nil {
+	switch {
+	case upd.Message != nil && upd.Message.Text == "":
+		return upd.Message.Caption
+	case upd.Message != nil:
+		return upd.Message.Text
+	case upd.CallbackQuery != nil:
+		return upd.CallbackQuery.Data
+	default:
 		return ""
 	}
-
-	return upd.Message.Text
 }
 
 // fetchType determines the event type from a Telegram update.
+// Callback queries from inline-mode messages carry no chat and are ignored.
 func fetchType(upd tg_custom_client.Update) events.Type {
-	if upd.Message == nil {
+	switch {
+	case upd.Message != nil:
+		return events.Message
+	case upd.CallbackQuery != nil && upd.CallbackQuery.Message != nil:
+		return events.CallbackQuery
+	default:
 		return events.Unknown
 	}
-
-	return events.Message
 }
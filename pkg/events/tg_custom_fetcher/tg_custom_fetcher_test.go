@@ -0,0 +1,314 @@
+package tg_custom_fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go_link_storage/pkg/clients/tg_custom_client"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/events/tg_processor"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeOffsets is an in-memory OffsetStore that records every stored offset.
+type fakeOffsets struct {
+	mu      sync.Mutex
+	offsets map[string]int
+	saved   []int
+}
+
+func (s *fakeOffsets) Offset(_ context.Context, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offsets[name], nil
+}
+
+func (s *fakeOffsets) SetOffset(_ context.Context, name string, offset int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.offsets == nil {
+		s.offsets = make(map[string]int)
+	}
+
+	s.offsets[name] = offset
+	s.saved = append(s.saved, offset)
+
+	return nil
+}
+
+// fakeUpdater serves messages with the given update IDs the way getUpdates does:
+// every call returns the updates at or after the requested offset.
+// Once there is nothing left to return it cancels the fetcher's context.
+type fakeUpdater struct {
+	ids     []int
+	cancel  context.CancelFunc
+	offsets []int                           // Requested offsets
+	opts    tg_custom_client.UpdatesOptions // Options of the last request
+}
+
+func (u *fakeUpdater) Updates(ctx context.Context, offset int, limit int, opts tg_custom_client.UpdatesOptions) ([]tg_custom_client.Update, error) {
+	u.offsets = append(u.offsets, offset)
+	u.opts = opts
+
+	var res []tg_custom_client.Update
+
+	for _, id := range u.ids {
+		if id >= offset && len(res) < limit {
+			res = append(res, tg_custom_client.Update{
+				ID:      id,
+				Message: &tg_custom_client.IncomingMessage{Text: strconv.Itoa(id)},
+			})
+		}
+	}
+
+	if len(res) == 0 {
+		u.cancel()
+		return nil, ctx.Err()
+	}
+
+	return res, nil
+}
+
+// handle reports every event of evs as handled.
+func handle(evs []events.Event) {
+	for _, ev := range evs {
+		ev.Done()
+	}
+}
+
+// texts returns the texts of evs.
+func texts(evs []events.Event) []string {
+	res := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		res = append(res, ev.Text)
+	}
+
+	return res
+}
+
+func TestStartCommitsOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tg := &fakeUpdater{ids: []int{5, 6}, cancel: cancel}
+	offsets := &fakeOffsets{}
+	f := &Fetcher{tg: tg, offsets: offsets}
+
+	var batches [][]string
+
+	err := f.Start(ctx, func(evs []events.Event) error {
+		batches = append(batches, texts(evs))
+		handle(evs)
+
+		return nil
+	}, 100)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if want := [][]string{{"5", "6"}}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+
+	// Every handled update is committed on its own.
+	if want := []int{6, 7}; !slices.Equal(offsets.saved, want) {
+		t.Errorf("saved offsets = %v, want %v", offsets.saved, want)
+	}
+
+	if tg.opts.Timeout != pollTimeout || !slices.Equal(tg.opts.AllowedUpdates, allowedUpdates) {
+		t.Errorf("Updates options = %+v, want long poll of %s for %v", tg.opts, pollTimeout, allowedUpdates)
+	}
+}
+
+func TestStartRefetchesFailedBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tg := &fakeUpdater{ids: []int{5, 6}, cancel: cancel}
+	offsets := &fakeOffsets{}
+	f := &Fetcher{tg: tg, offsets: offsets}
+
+	var batches [][]string
+
+	err := f.Start(ctx, func(evs []events.Event) error {
+		batches = append(batches, texts(evs))
+		if len(batches) == 1 {
+			if len(offsets.saved) != 0 {
+				t.Errorf("offset saved before the batch was handled: %v", offsets.saved)
+			}
+
+			return errors.New("storage is down")
+		}
+
+		handle(evs)
+
+		return nil
+	}, 100)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if want := [][]string{{"5", "6"}, {"5", "6"}}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want the failed batch again %v", batches, want)
+	}
+
+	if want := []int{0, 0, 7}; !slices.Equal(tg.offsets, want) {
+		t.Errorf("requested offsets = %v, want %v", tg.offsets, want)
+	}
+
+	if want := []int{6, 7}; !slices.Equal(offsets.saved, want) {
+		t.Errorf("saved offsets = %v, want only %v", offsets.saved, want)
+	}
+}
+
+func TestStartResumesFromStoredOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tg := &fakeUpdater{ids: []int{5, 6, 7}, cancel: cancel}
+	offsets := &fakeOffsets{offsets: map[string]int{offsetName: 6}}
+	f := &Fetcher{tg: tg, offsets: offsets}
+
+	var batches [][]string
+
+	err := f.Start(ctx, func(evs []events.Event) error {
+		batches = append(batches, texts(evs))
+		handle(evs)
+
+		return nil
+	}, 100)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if len(tg.offsets) == 0 || tg.offsets[0] != 6 {
+		t.Errorf("requested offsets = %v, want to start at 6", tg.offsets)
+	}
+
+	if want := [][]string{{"6", "7"}}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v, want %v", batches, want)
+	}
+
+	if got, _ := offsets.Offset(ctx, offsetName); got != 8 {
+		t.Errorf("stored offset = %d, want 8", got)
+	}
+}
+
+func TestStartCommitsHandledPrefix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tg := &fakeUpdater{ids: []int{5, 6, 7}, cancel: cancel}
+	offsets := &fakeOffsets{}
+	f := &Fetcher{tg: tg, offsets: offsets}
+
+	var queued []events.Event
+
+	err := f.Start(ctx, func(evs []events.Event) error {
+		queued = append(queued, evs...)
+		return nil
+	}, 100)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	// The next batch is requested before the first one is handled.
+	if want := []int{0, 8}; !slices.Equal(tg.offsets, want) {
+		t.Errorf("requested offsets = %v, want %v", tg.offsets, want)
+	}
+
+	// Updates finish out of order: nothing can be committed while update 5 is in flight.
+	queued[1].Done()
+	queued[2].Done()
+
+	if len(offsets.saved) != 0 {
+		t.Errorf("saved offsets = %v while update 5 is in flight, want none", offsets.saved)
+	}
+
+	queued[0].Done()
+
+	if want := []int{8}; !slices.Equal(offsets.saved, want) {
+		t.Errorf("saved offsets = %v, want %v", offsets.saved, want)
+	}
+}
+
+func TestEventForwarded(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     string
+		wantText   string
+		wantSource tg_processor.Source
+		wantEnts   int
+	}{
+		{
+			name: "public channel post with caption",
+			update: `{"update_id": 1, "message": {
+				"message_id": 5, "from": {"username": "alice"}, "chat": {"id": 10},
+				"caption": "Read https://example.com",
+				"caption_entities": [{"type": "url", "offset": 5, "length": 19}],
+				"forward_origin": {"type": "channel", "message_id": 42,
+					"chat": {"id": -1001234567890, "title": "Go News", "username": "gonews"}}}}`,
+			wantText:   "Read https://example.com",
+			wantSource: tg_processor.Source{Name: "Go News", URL: "https://t.me/gonews/42"},
+			wantEnts:   1,
+		},
+		{
+			name: "private channel post",
+			update: `{"update_id": 2, "message": {
+				"message_id": 6, "from": {"username": "alice"}, "chat": {"id": 10},
+				"text": "https://example.com",
+				"entities": [{"type": "url", "offset": 0, "length": 19}],
+				"forward_origin": {"type": "channel", "message_id": 7,
+					"chat": {"id": -1001234567890, "title": "Secret"}}}}`,
+			wantText:   "https://example.com",
+			wantSource: tg_processor.Source{Name: "Secret", URL: "https://t.me/c/1234567890/7"},
+			wantEnts:   1,
+		},
+		{
+			name: "user with hidden account",
+			update: `{"update_id": 3, "message": {
+				"message_id": 7, "from": {"username": "alice"}, "chat": {"id": 10},
+				"text": "https://example.com",
+				"forward_origin": {"type": "hidden_user", "sender_user_name": "Bob"}}}`,
+			wantText:   "https://example.com",
+			wantSource: tg_processor.Source{Name: "Bob"},
+		},
+		{
+			name: "not forwarded",
+			update: `{"update_id": 4, "message": {
+				"message_id": 8, "from": {"username": "alice"}, "chat": {"id": 10}, "text": "/rnd"}}`,
+			wantText: "/rnd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upd tg_custom_client.Update
+			if err := json.Unmarshal([]byte(tt.update), &upd); err != nil {
+				t.Fatalf("decode update: %v", err)
+			}
+
+			evt := Event(upd)
+
+			if evt.Type != events.Message || evt.Text != tt.wantText {
+				t.Fatalf("Event() = %+v, want message %q", evt, tt.wantText)
+			}
+
+			meta := evt.Meta.(tg_processor.Meta)
+
+			if !reflect.DeepEqual(meta.Source, tt.wantSource) {
+				t.Errorf("Source = %+v, want %+v", meta.Source, tt.wantSource)
+			}
+
+			if len(meta.Entities) != tt.wantEnts {
+				t.Errorf("got %d entities, want %d", len(meta.Entities), tt.wantEnts)
+			}
+		})
+	}
+}
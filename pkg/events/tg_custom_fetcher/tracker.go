@@ -0,0 +1,83 @@
+package tg_custom_fetcher
+
+import (
+	"slices"
+	"sync"
+)
+
+// tracker follows the updates being handled and finds the offset that is
+// safe to commit: the ID of the oldest update that is not handled yet, or the
+// offset after the last fetched update once every update is handled.
+// Updates finish in any order, since the events of different chats are
+// handled in parallel.
+type tracker struct {
+	mu   sync.Mutex
+	ids  []int        // IDs of the tracked updates not committed yet, ascending
+	done map[int]bool // Handled updates among ids
+	next int          // Offset after the last tracked update
+}
+
+// reset forgets every tracked update and starts tracking at offset.
+func (t *tracker) reset(offset int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ids = nil
+	t.done = make(map[int]bool)
+	t.next = offset
+}
+
+// add starts tracking updates with the given ascending IDs, fetched up to next.
+func (t *tracker) add(ids []int, next int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done == nil {
+		t.done = make(map[int]bool)
+	}
+
+	t.ids = append(t.ids, ids...)
+	t.next = next
+}
+
+// drop forgets the updates from offset on, which were fetched but never handed out.
+func (t *tracker) drop(offset int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ids = slices.DeleteFunc(t.ids, func(id int) bool { return id >= offset })
+	t.next = offset
+}
+
+// finish marks the update as handled. It returns the offset that is safe to
+// commit and whether the update moved it forward.
+func (t *tracker) finish(id int) (offset int, advanced bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	before := t.offset()
+
+	if _, ok := slices.BinarySearch(t.ids, id); !ok {
+		return before, false
+	}
+
+	t.done[id] = true
+
+	for len(t.ids) > 0 && t.done[t.ids[0]] {
+		delete(t.done, t.ids[0])
+		t.ids = t.ids[1:]
+	}
+
+	after := t.offset()
+
+	return after, after != before
+}
+
+// offset returns the offset that is safe to commit. t.mu must be held.
+func (t *tracker) offset() int {
+	if len(t.ids) > 0 {
+		return t.ids[0]
+	}
+
+	return t.next
+}
@@ -5,26 +5,34 @@ import (
 	"go_link_storage/pkg/clients/tg_negasus_client"
 	"go_link_storage/pkg/events"
 	"go_link_storage/pkg/events/tg_processor"
+	"go_link_storage/pkg/lib/e"
 	"log"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
 
+// Fetcher receives Telegram updates using github.com/go-telegram/bot.
 type Fetcher struct {
-	tg *tg_negasus_client.Client // Telegram API client
+	tg    *tg_negasus_client.Client // Telegram API client
+	debug bool                      // Whether the library logs every request
 }
 
-// New creates a new Telegram event processor with the given client.
-func New(client *tg_negasus_client.Client) *Fetcher {
+// New creates a new Telegram event fetcher with the given client.
+// debug enables the library's request logging.
+func New(client *tg_negasus_client.Client, debug bool) *Fetcher {
 	return &Fetcher{
-		tg: client,
+		tg:    client,
+		debug: debug,
 	}
 }
 
-func (f *Fetcher) Start(handleEventsCallback func(events []events.Event) error, batchSize int) {
+// Start receives updates with github.com/go-telegram/bot until ctx is canceled.
+// Handlers run synchronously, so updates are queued in the order they arrive;
+// they only queue the update and do not wait for it to be handled.
+func (f *Fetcher) Start(ctx context.Context, handleEventsCallback func(events []events.Event) error, batchSize int) error {
 	opts := []bot.Option{
-		bot.WithDebug(),
+		bot.WithNotAsyncHandlers(),
 		bot.WithDefaultHandler(func(ctx context.Context, b *bot.Bot, update *models.Update) {
 			res := make([]events.Event, 0, 1)
 			res = append(res, event(update))
@@ -34,13 +42,19 @@ func (f *Fetcher) Start(handleEventsCallback func(events []events.Event) error,
 		}),
 	}
 
+	if f.debug {
+		opts = append(opts, bot.WithDebug())
+	}
+
 	b, err := bot.New(f.tg.Token, opts...)
 	if err != nil {
-		panic(err)
+		return e.Wrap("cannot create bot", err)
 	}
 
-	f.tg.Bot = b
-	f.tg.Bot.Start(f.tg.Ctx)
+	f.tg.SetBot(b)
+	b.Start(ctx)
+
+	return nil
 }
 
 // event converts a Telegram update to an events.Event.
@@ -48,34 +62,125 @@ func event(upd *models.Update) events.Event {
 	updType := fetchType(upd)
 
 	res := events.Event{
-		Type: fetchType(upd),
+		Type: updType,
 		Text: fetchText(upd),
 	}
 
-	if updType == events.Message {
+	switch updType {
+	case events.Message:
 		res.Meta = tg_processor.Meta{
 			ChatID:   int(upd.Message.Chat.ID),
+			UserID:   upd.Message.From.ID,
 			Username: upd.Message.From.Username,
+			Entities: entities(upd.Message),
+			Source:   source(upd.Message.ForwardOrigin),
+		}
+	case events.CallbackQuery:
+		chatID, messageID := callbackMessage(upd.CallbackQuery)
+
+		res.Meta = tg_processor.CallbackMeta{
+			QueryID:   upd.CallbackQuery.ID,
+			ChatID:    chatID,
+			MessageID: messageID,
+			UserID:    upd.CallbackQuery.From.ID,
+			Username:  upd.CallbackQuery.From.Username,
+			Data:      upd.CallbackQuery.Data,
 		}
 	}
 
 	return res
 }
 
+// entities converts the entities of the message text, or of the caption
+// for media messages, to the processor's representation.
+func entities(msg *models.Message) []tg_processor.Entity {
+	ents := msg.Entities
+	if msg.Text == "" {
+		ents = msg.CaptionEntities
+	}
+
+	if len(ents) == 0 {
+		return nil
+	}
+
+	res := make([]tg_processor.Entity, 0, len(ents))
+
+	for _, ent := range ents {
+		res = append(res, tg_processor.Entity{
+			Type:   string(ent.Type),
+			Offset: ent.Offset,
+			Length: ent.Length,
+			URL:    ent.URL,
+		})
+	}
+
+	return res
+}
+
+// source describes where a forwarded message came from.
+// Messages that were not forwarded have the zero Source.
+func source(origin *models.MessageOrigin) tg_processor.Source {
+	if origin == nil {
+		return tg_processor.Source{}
+	}
+
+	switch {
+	case origin.MessageOriginChannel != nil:
+		o := origin.MessageOriginChannel
+		return tg_processor.ChannelSource(o.Chat.ID, o.Chat.Title, o.Chat.Username, o.MessageID)
+	case origin.MessageOriginChat != nil:
+		o := origin.MessageOriginChat
+		return tg_processor.ChatSource(o.SenderChat.Title, o.SenderChat.Username)
+	case origin.MessageOriginUser != nil:
+		u := origin.MessageOriginUser.SenderUser
+		return tg_processor.UserSource(u.FirstName, u.LastName, u.Username)
+	case origin.MessageOriginHiddenUser != nil:
+		return tg_processor.Source{Name: origin.MessageOriginHiddenUser.SenderUserName}
+	default:
+		return tg_processor.Source{}
+	}
+}
+
 // fetchText extracts the text content from a Telegram update.
+// Media messages have no text, so their caption is used instead.
 func fetchText(upd *models.Update) string {
-	if upd.Message == nil {
+	switch {
+	case upd.Message != nil && upd.Message.Text == "":
+		return upd.Message.Caption
+	case upd.Message != nil:
+		return upd.Message.Text
+	case upd.CallbackQuery != nil:
+		return upd.CallbackQuery.Data
+	default:
 		return ""
 	}
-
-	return upd.Message.Text
 }
 
 // fetchType determines the event type from a Telegram update.
+// Callback queries from inline-mode messages carry no chat and are ignored.
 func fetchType(upd *models.Update) events.Type {
-	if upd.Message == nil {
+	switch {
+	case upd.Message != nil:
+		return events.Message
+	case upd.CallbackQuery != nil && hasCallbackMessage(upd.CallbackQuery):
+		return events.CallbackQuery
+	default:
 		return events.Unknown
 	}
+}
+
+// hasCallbackMessage reports whether the query is attached to a chat message.
+func hasCallbackMessage(q *models.CallbackQuery) bool {
+	return q.Message.Message != nil || q.Message.InaccessibleMessage != nil
+}
+
+// callbackMessage returns the chat and message IDs the query is attached to.
+func callbackMessage(q *models.CallbackQuery) (chatID int, messageID int) {
+	if m := q.Message.Message; m != nil {
+		return int(m.Chat.ID), m.ID
+	}
+
+	m := q.Message.InaccessibleMessage
 
-	return events.Message
+	return int(m.Chat.ID), m.MessageID
 }
@@ -0,0 +1,83 @@
+package tg_negasus_fetcher
+
+import (
+	"encoding/json"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/events/tg_processor"
+	"reflect"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		update string
+		want   events.Event
+	}{
+		{
+			name: "message",
+			update: `{"update_id": 1, "message": {"message_id": 5, "text": "https://example.com",
+				"entities": [{"type": "url", "offset": 0, "length": 19}],
+				"from": {"id": 1001, "username": "alice"}, "chat": {"id": 42}}}`,
+			want: events.Event{
+				Type: events.Message,
+				Text: "https://example.com",
+				Meta: tg_processor.Meta{
+					ChatID:   42,
+					UserID:   1001,
+					Username: "alice",
+					Entities: []tg_processor.Entity{{Type: tg_processor.EntityURL, Length: 19}},
+				},
+			},
+		},
+		{
+			name: "callback",
+			update: `{"update_id": 2, "callback_query": {"id": "q1", "data": "list:1",
+				"from": {"id": 1001, "username": "alice"},
+				"message": {"message_id": 5, "date": 1700000000, "chat": {"id": 42}}}}`,
+			want: events.Event{
+				Type: events.CallbackQuery,
+				Text: "list:1",
+				Meta: tg_processor.CallbackMeta{QueryID: "q1", ChatID: 42, MessageID: 5, UserID: 1001, Username: "alice", Data: "list:1"},
+			},
+		},
+		{
+			// Telegram sends messages older than 48 hours with a zero date.
+			name: "callback on inaccessible message",
+			update: `{"update_id": 3, "callback_query": {"id": "q2", "data": "list:1",
+				"from": {"id": 1001},
+				"message": {"message_id": 6, "date": 0, "chat": {"id": 42}}}}`,
+			want: events.Event{
+				Type: events.CallbackQuery,
+				Text: "list:1",
+				Meta: tg_processor.CallbackMeta{QueryID: "q2", ChatID: 42, MessageID: 6, UserID: 1001, Data: "list:1"},
+			},
+		},
+		{
+			name: "inline callback",
+			update: `{"update_id": 4, "callback_query": {"id": "q3", "data": "list:1",
+				"from": {"id": 1001}, "inline_message_id": "m1"}}`,
+			want: events.Event{Type: events.Unknown, Text: "list:1"},
+		},
+		{
+			name:   "other update",
+			update: `{"update_id": 5, "edited_message": {"message_id": 5, "text": "hi", "chat": {"id": 42}}}`,
+			want:   events.Event{Type: events.Unknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upd models.Update
+			if err := json.Unmarshal([]byte(tt.update), &upd); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			if got := event(&upd); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("event() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package tg_processor
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/lib/e"
+	"go_link_storage/pkg/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callback data has the form "<action>:<args>"; the prefixes below include
+// the separator. Telegram limits callback data to 64 bytes.
+const (
+	listCallbackPrefix    = "list:"    // /list navigation, args: page
+	archiveCallbackPrefix = "archive:" // /archive navigation, args: page
+	putBackCallbackPrefix = "unread:"  // Put back button of /rnd, args: page ID
+	restoreCallbackPrefix = "restore:" // Put back button of /archive, args: page and page ID
+	searchCallbackPrefix  = "search:"  // /search navigation, args: page and query
+
+	callbackArgSep = ":" // Separates callback arguments
+
+	// maxSearchQuery is the longest query in bytes that fits into the callback
+	// data of /search navigation along with a page number of up to four digits.
+	maxSearchQuery = 64 - len(searchCallbackPrefix) - 4 - len(callbackArgSep)
+)
+
+// processCallback handles callback query events produced by inline keyboard buttons.
+// The query is always answered, so the client stops showing a progress indicator,
+// even if the action fails.
+func (p *Processor) processCallback(ctx context.Context, event events.Event) (err error) {
+	defer func() { err = e.WrapIfErr("cannot process callback", err) }()
+
+	meta, err := callbackMeta(event)
+	if err != nil {
+		return err
+	}
+
+	var notice string
+
+	err = p.migrateUser(ctx, meta.UserID, meta.Username)
+	if err == nil {
+		notice, err = p.doCallback(ctx, meta)
+	}
+
+	switch {
+	case errors.Is(err, ErrUnknownCallback):
+		notice = msgUnknownAction
+	case err != nil:
+		notice = msgActionFailed
+	}
+
+	if ansErr := p.tg.AnswerCallbackQuery(ctx, meta.QueryID, notice); ansErr != nil {
+		return errors.Join(err, ansErr)
+	}
+
+	return err
+}
+
+// doCallback routes the callback to the action encoded in its data.
+// It returns the notification text to show to the user, if any.
+func (p *Processor) doCallback(ctx context.Context, meta CallbackMeta) (string, error) {
+	switch data := meta.Data; {
+	case strings.HasPrefix(data, listCallbackPrefix):
+		return "", p.showListPage(ctx, meta, unreadView, strings.TrimPrefix(data, listCallbackPrefix))
+	case strings.HasPrefix(data, archiveCallbackPrefix):
+		return "", p.showListPage(ctx, meta, archiveView, strings.TrimPrefix(data, archiveCallbackPrefix))
+	case strings.HasPrefix(data, searchCallbackPrefix):
+		return "", p.showSearchPage(ctx, meta, strings.TrimPrefix(data, searchCallbackPrefix))
+	case strings.HasPrefix(data, putBackCallbackPrefix):
+		return msgPutBack, p.putBack(ctx, meta, strings.TrimPrefix(data, putBackCallbackPrefix))
+	case strings.HasPrefix(data, restoreCallbackPrefix):
+		return msgPutBack, p.restore(ctx, meta, strings.TrimPrefix(data, restoreCallbackPrefix))
+	default:
+		return "", ErrUnknownCallback
+	}
+}
+
+// showListPage replaces the list message with the requested page of the view.
+func (p *Processor) showListPage(ctx context.Context, meta CallbackMeta, view listView, arg string) (err error) {
+	defer func() { err = e.WrapIfErr("cannot show list page", err) }()
+
+	page, err := parsePage(arg)
+	if err != nil {
+		return err
+	}
+
+	return p.editListPage(ctx, meta, view, page)
+}
+
+// showSearchPage replaces the search results message with the requested page of the results.
+func (p *Processor) showSearchPage(ctx context.Context, meta CallbackMeta, args string) (err error) {
+	defer func() { err = e.WrapIfErr("cannot show search page", err) }()
+
+	pageArg, query, ok := strings.Cut(args, callbackArgSep)
+	if !ok || query == "" {
+		return ErrUnknownCallback
+	}
+
+	page, err := parsePage(pageArg)
+	if err != nil {
+		return err
+	}
+
+	return p.editListPage(ctx, meta, searchView(query), page)
+}
+
+// putBack returns a page sent by /rnd to the unread pool.
+func (p *Processor) putBack(ctx context.Context, meta CallbackMeta, id string) error {
+	return e.WrapIfErr("cannot put page back", p.markUnread(ctx, meta.UserID, id))
+}
+
+// restore returns a page listed by /archive to the unread pool
+// and refreshes the archive page it was listed on.
+func (p *Processor) restore(ctx context.Context, meta CallbackMeta, args string) (err error) {
+	defer func() { err = e.WrapIfErr("cannot restore page", err) }()
+
+	pageArg, id, ok := strings.Cut(args, callbackArgSep)
+	if !ok {
+		return ErrUnknownCallback
+	}
+
+	page, err := parsePage(pageArg)
+	if err != nil {
+		return err
+	}
+
+	if err := p.markUnread(ctx, meta.UserID, id); err != nil {
+		return err
+	}
+
+	return p.editListPage(ctx, meta, archiveView, page)
+}
+
+// markUnread clears the read time of the user's page with the given ID.
+// A page that no longer exists is reported to the caller as ErrUnknownCallback.
+func (p *Processor) markUnread(ctx context.Context, userID int64, id string) error {
+	page := &storage.Page{ID: id, UserID: userID}
+
+	err := p.storage.SetReadAt(ctx, page, time.Time{})
+	if errors.Is(err, storage.ErrPageNotFound) {
+		return e.Wrap("cannot mark page unread", ErrUnknownCallback)
+	}
+
+	return err
+}
+
+// editListPage replaces the message the callback came from with a page of the view.
+func (p *Processor) editListPage(ctx context.Context, meta CallbackMeta, view listView, page int) error {
+	text, kb, err := p.renderList(ctx, meta.UserID, view, page)
+	if err != nil {
+		return err
+	}
+
+	return p.tg.EditKeyboard(ctx, meta.ChatID, meta.MessageID, text, kb)
+}
+
+// parsePage parses a zero-based page number from callback data.
+func parsePage(arg string) (int, error) {
+	page, err := strconv.Atoi(arg)
+	if err != nil || page < 0 {
+		return 0, ErrUnknownCallback
+	}
+
+	return page, nil
+}
+
+// callbackMeta extracts CallbackMeta from an event, returning an error if the meta type is incorrect.
+func callbackMeta(event events.Event) (CallbackMeta, error) {
+	res, ok := event.Meta.(CallbackMeta)
+	if !ok {
+		return CallbackMeta{}, e.Wrap("cannot get meta", ErrUnknownMetaType)
+	}
+
+	return res, nil
+}
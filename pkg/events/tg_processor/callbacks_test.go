@@ -0,0 +1,89 @@
+package tg_processor
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"testing"
+	"time"
+)
+
+func TestProcessCallbackAnswers(t *testing.T) {
+	ctx := context.Background()
+	store := files.New(t.TempDir())
+
+	page := &storage.Page{URL: "https://example.com/a", UserID: 7}
+	if err := store.Save(ctx, page); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		editErr  error
+		want     string // Text of the answer
+		wantErr  error  // Error the processing fails with; any error if errAny
+		wantEdit bool   // Whether the message is edited
+	}{
+		{name: "list page", data: "list:0", wantEdit: true},
+		{name: "put back", data: putBackCallbackPrefix + page.ID, want: msgPutBack},
+		{name: "unknown action", data: "nope:1", want: msgUnknownAction, wantErr: ErrUnknownCallback},
+		{name: "empty data", want: msgUnknownAction, wantErr: ErrUnknownCallback},
+		{name: "removed page", data: putBackCallbackPrefix + "nope", want: msgUnknownAction, wantErr: ErrUnknownCallback},
+		{name: "bad page number", data: "archive:x", want: msgUnknownAction, wantErr: ErrUnknownCallback},
+		{name: "action fails", data: "list:0", editErr: errMessageGone, want: msgActionFailed, wantErr: errMessageGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// /rnd archives the page, so there is something to put back.
+			if err := store.SetReadAt(ctx, page, time.Now()); err != nil {
+				t.Fatalf("SetReadAt: %v", err)
+			}
+
+			tg := &fakeClient{editErr: tt.editErr}
+			p := New(tg, store, nil, "")
+
+			err := p.Process(ctx, events.Event{
+				Type: events.CallbackQuery,
+				Text: tt.data,
+				Meta: CallbackMeta{QueryID: "q1", ChatID: 1, MessageID: 3, UserID: 7, Username: "alice", Data: tt.data},
+			})
+
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("Process() error = %v", err)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("Process() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if want := (answer{queryID: "q1", text: tt.want}); len(tg.answers) != 1 || tg.answers[0] != want {
+				t.Errorf("answers = %+v, want only %+v", tg.answers, want)
+			}
+
+			if edited := len(tg.sent) > 0; edited != tt.wantEdit {
+				t.Errorf("message edited = %v, want %v", edited, tt.wantEdit)
+			}
+		})
+	}
+}
+
+func TestProcessCallbackWithoutMeta(t *testing.T) {
+	tg := &fakeClient{}
+	p := New(tg, files.New(t.TempDir()), nil, "")
+
+	err := p.Process(context.Background(), events.Event{Type: events.CallbackQuery, Meta: Meta{ChatID: 1}})
+	if !errors.Is(err, ErrUnknownMetaType) {
+		t.Fatalf("Process() error = %v, want %v", err, ErrUnknownMetaType)
+	}
+
+	// There is no query ID to answer.
+	if len(tg.answers) != 0 {
+		t.Errorf("answers = %+v, want none", tg.answers)
+	}
+}
+
+// errMessageGone is returned by the fake client when the message to edit no longer exists.
+var errMessageGone = errors.New("message to edit not found")
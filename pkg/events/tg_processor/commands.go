@@ -1,136 +1,500 @@
 package tg_processor
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/exchange"
 	"go_link_storage/pkg/lib/e"
 	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/urlnorm"
 	"log"
-	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	RndCmd   = "/rnd"   // Command to get a random saved page
-	HelpCmd  = "/help"  // Command to show help message
-	StartCmd = "/start" // Command to start the bot
+	RndCmd     = "/rnd"     // Command to get a random unread page
+	HelpCmd    = "/help"    // Command to show help message
+	StartCmd   = "/start"   // Command to start the bot
+	ListCmd    = "/list"    // Command to list unread pages
+	ArchiveCmd = "/archive" // Command to list read pages
+	SearchCmd  = "/search"  // Command to search saved pages
+	TagCmd     = "/tag"     // Command to tag a page from /list
+	TagsCmd    = "/tags"    // Command to list tags with page counts
+	ExportCmd  = "/export"  // Command to export pages as a file
 )
 
-// doCmd processes a command or URL from a user message.
-func (p *Processor) doCmd(
-	text string,
-	chatID int,
-	username string) error {
-
+// doCmd processes a command or the links in a user message.
+func (p *Processor) doCmd(ctx context.Context, text string, meta Meta) error {
 	text = strings.TrimSpace(text)
 
-	log.Printf("new command '%s' from '%s'", text, username)
+	log.Printf("new command '%s' from '%s'", text, meta.Username)
+
+	if !strings.HasPrefix(text, "/") {
+		if links := extractLinks(text, meta.Entities); len(links) > 0 {
+			return p.saveLinks(ctx, meta, links, extractTags(text))
+		}
+	}
+
+	return p.runCommand(ctx, text, meta.ChatID, meta.UserID)
+}
+
+// newCommands registers the bot commands of the bot with the given username.
+// /help and the command menu list them in this order.
+func (p *Processor) newCommands(botName string) *router {
+	return newRouter(botName,
+		&command{
+			name:        RndCmd,
+			aliases:     []string{"/random"},
+			description: "Send a random unread page, optionally with the given tag, and move it to the archive",
+			args:        []arg{{name: "#tag", optional: true}},
+			handler: func(ctx context.Context, req request) error {
+				return p.sendRandom(ctx, req.chatID, req.userID, req.arg(0))
+			},
+		},
+		&command{
+			name:        ListCmd,
+			description: "List unread pages",
+			handler: func(ctx context.Context, req request) error {
+				return p.sendList(ctx, req.chatID, req.userID)
+			},
+		},
+		&command{
+			name:        ArchiveCmd,
+			aliases:     []string{"/read"},
+			description: "List read pages",
+			handler: func(ctx context.Context, req request) error {
+				return p.sendArchive(ctx, req.chatID, req.userID)
+			},
+		},
+		&command{
+			name:        SearchCmd,
+			description: "Search saved pages by words in their link, title, description, tags and note",
+			args:        []arg{{name: "query", rest: true}},
+			handler: func(ctx context.Context, req request) error {
+				return p.sendSearch(ctx, req.chatID, req.userID, strings.Join(req.args, " "))
+			},
+		},
+		&command{
+			name:        TagCmd,
+			description: "Add tags to the page with the given number in /list",
+			args:        []arg{{name: "n"}, {name: "tag", rest: true}},
+			handler: func(ctx context.Context, req request) error {
+				return p.tagPage(ctx, req.chatID, req.userID, req.arg(0), req.args[1:])
+			},
+		},
+		&command{
+			name:        TagsCmd,
+			description: "List your tags with the number of pages",
+			handler: func(ctx context.Context, req request) error {
+				return p.sendTags(ctx, req.chatID, req.userID)
+			},
+		},
+		&command{
+			name:        ExportCmd,
+			description: "Send every saved page as a file: html bookmarks for browsers, json or csv",
+			args:        []arg{{name: "format", optional: true}},
+			handler: func(ctx context.Context, req request) error {
+				return p.sendExport(ctx, req.chatID, req.userID, req.arg(0))
+			},
+		},
+		&command{
+			name:        HelpCmd,
+			description: "Show the commands or help for one of them",
+			args:        []arg{{name: "command", optional: true}},
+			handler: func(ctx context.Context, req request) error {
+				return p.sendHelp(ctx, req.chatID, req.arg(0))
+			},
+		},
+		&command{
+			name:        StartCmd,
+			description: "Show the welcome message",
+			hidden:      true,
+			handler: func(ctx context.Context, req request) error {
+				return p.sendHello(ctx, req.chatID)
+			},
+		},
+	)
+}
+
+// runCommand parses a command message and runs the matching registered command.
+// Unknown commands and invalid arguments are reported to the user; commands
+// addressed to another bot in a group chat are ignored.
+func (p *Processor) runCommand(ctx context.Context, text string, chatID int, userID int64) error {
+	sendMsg := NewMessageSender(ctx, chatID, p.tg)
 
-	if isAddCmd(text) {
-		return p.savePage(chatID, text, username)
+	if !strings.HasPrefix(text, "/") {
+		return sendMsg(msgUnknownCommand)
 	}
 
-	switch text {
-	case RndCmd:
-		return p.sendRandom(chatID, username)
-	case HelpCmd:
-		return p.sendHelp(chatID)
-	case StartCmd:
-		return p.sendHello(chatID)
-	default:
-		return p.tg.SendMessage(chatID, msgUnknownCommand)
+	name, bot, args, err := parseCommand(text)
+	if !p.commands.addressedTo(bot) {
+		return nil
 	}
+
+	if err != nil {
+		return sendMsg(msgUnclosedQuote)
+	}
+
+	cmd, ok := p.commands.lookup(name)
+	if !ok {
+		return sendMsg(msgUnknownCommand)
+	}
+
+	if !cmd.accepts(len(args)) {
+		return sendMsg(fmt.Sprintf(msgUsage, cmd.usage()))
+	}
+
+	return cmd.handler(ctx, request{chatID: chatID, userID: userID, args: args})
 }
 
-// savePage saves a page URL to storage for the given user.
-func (p *Processor) savePage(
-	chatID int,
-	pageURL string,
-	username string) (err error) {
+// PublishCommands sets the Telegram command menu to the registered commands.
+func (p *Processor) PublishCommands(ctx context.Context) error {
+	if err := p.tg.SetCommands(ctx, p.commands.menu()); err != nil {
+		return e.Wrap("cannot publish commands", err)
+	}
 
+	return nil
+}
+
+// saveLinks saves every link for the sender of the message with the given tags
+// and replies with what was saved and which links had been saved before.
+// Links are saved and reported in their canonical form. Links of a forwarded
+// message remember where the message came from.
+func (p *Processor) saveLinks(ctx context.Context, meta Meta, links []string, tags []string) (err error) {
 	defer func() {
 		err = e.WrapIfErr("cannot process command: save page", err)
 	}()
 
-	sendMsg := NewMessageSender(chatID, p.tg)
+	var saved, skipped []string
+
+	for _, link := range links {
+		link = urlnorm.Normalize(link)
+
+		page := &storage.Page{
+			URL:        link,
+			UserID:     meta.UserID,
+			UserName:   meta.Username,
+			Tags:       tags,
+			SourceName: meta.Source.Name,
+			SourceURL:  meta.Source.URL,
+		}
+
+		exists, err := p.storage.Exists(ctx, page)
+		if err != nil {
+			return err
+		}
+		if exists {
+			skipped = append(skipped, link)
+			continue
+		}
+
+		if err := p.storage.Save(ctx, page); err != nil {
+			return err
+		}
+
+		// A page saved concurrently by another message gets no ID.
+		if p.previews != nil && page.ID != "" {
+			p.previews.Enqueue(page)
+		}
 
-	page := &storage.Page{
-		URL:      pageURL,
-		UserName: username,
+		saved = append(saved, link)
 	}
 
-	exists, err := p.storage.Exists(context.Background(), page)
-	if err != nil {
-		return err
+	return p.tg.SendMessage(ctx, meta.ChatID, saveSummary(saved, skipped))
+}
+
+// saveSummary describes the outcome of saveLinks. A single link gets a short reply.
+func saveSummary(saved, skipped []string) string {
+	switch {
+	case len(saved) == 1 && len(skipped) == 0:
+		return msgSaved
+	case len(saved) == 0 && len(skipped) == 1:
+		return msgAlreadyExists
 	}
-	if exists {
-		return sendMsg(msgAlreadyExists)
+
+	var parts []string
+
+	if len(saved) > 0 {
+		parts = append(parts, fmt.Sprintf(msgSavedLinks, len(saved))+bulletList(saved))
 	}
 
-	if err := p.storage.Save(context.Background(), page); err != nil {
-		return err
+	if len(skipped) > 0 {
+		parts = append(parts, fmt.Sprintf(msgSkippedLinks, len(skipped))+bulletList(skipped))
 	}
 
-	if err := sendMsg(msgSaved); err != nil {
-		return err
+	return strings.Join(parts, "\n\n")
+}
+
+// bulletList formats items as lines starting with a bullet.
+func bulletList(items []string) string {
+	var b strings.Builder
+
+	for _, item := range items {
+		b.WriteString("\n• ")
+		b.WriteString(item)
 	}
 
-	return nil
+	return b.String()
 }
 
-// sendRandom retrieves and sends a random saved page to the user, then removes it.
+// sendRandom sends a random unread page to the user and moves it to the archive.
+// If tagArg is not empty, only pages with that tag are picked from.
+// The message carries a button that returns the page to the unread pool.
 func (p *Processor) sendRandom(
+	ctx context.Context,
 	chatID int,
-	username string) (err error) {
+	userID int64,
+	tagArg string) (err error) {
 
 	defer func() { err = e.WrapIfErr("cannot do command: send random", err) }()
 
-	sendMsg := NewMessageSender(chatID, p.tg)
+	sendMsg := NewMessageSender(ctx, chatID, p.tg)
+
+	unread := storage.Filter{State: storage.StateUnread}
+	noPages := msgNoSavedPages
 
-	page, err := p.storage.PickRandom(context.Background(), username)
+	if tagArg != "" {
+		tag, ok := parseTag(tagArg)
+		if !ok {
+			return sendMsg(msgInvalidTag)
+		}
+
+		unread.Tag = tag
+		noPages = fmt.Sprintf(msgNoTaggedPages, tagPrefix+tag)
+	}
+
+	page, err := p.storage.PickRandom(ctx, userID, unread)
 	if err != nil && !errors.Is(err, storage.ErrNoSavedPages) {
 		return err
 	}
 	if errors.Is(err, storage.ErrNoSavedPages) {
-		return sendMsg(msgNoSavedPages)
+		return sendMsg(noPages)
+	}
+
+	kb := events.Keyboard{{{Text: msgPutBackButton, Data: putBackCallbackPrefix + page.ID}}}
+
+	text := page.URL
+	if page.Title != "" {
+		text = page.Title + "\n" + text
 	}
 
-	if err := sendMsg(page.URL); err != nil {
+	if len(page.Tags) > 0 {
+		text += "\n" + formatTags(page.Tags)
+	}
+
+	if src := sourceLine(page); src != "" {
+		text += "\n\n" + src
+	}
+
+	if err := p.tg.SendKeyboard(ctx, chatID, text, kb); err != nil {
 		return err
 	}
 
-	return p.storage.Remove(context.Background(), page)
+	return p.storage.SetReadAt(ctx, page, time.Now().UTC())
 }
 
-// sendHelp sends the help message to the user.
-func (p *Processor) sendHelp(chatID int) error {
-	return p.tg.SendMessage(chatID, msgHelp)
+// sendList sends the first page of the user's unread pages with navigation buttons.
+func (p *Processor) sendList(ctx context.Context, chatID int, userID int64) (err error) {
+	defer func() { err = e.WrapIfErr("cannot do command: list", err) }()
+
+	return p.sendListView(ctx, chatID, userID, unreadView)
+}
+
+// sendArchive sends the first page of the user's read pages with navigation
+// and put back buttons.
+func (p *Processor) sendArchive(ctx context.Context, chatID int, userID int64) (err error) {
+	defer func() { err = e.WrapIfErr("cannot do command: archive", err) }()
+
+	return p.sendListView(ctx, chatID, userID, archiveView)
+}
+
+// sendSearch sends the first page of the user's pages matching query with navigation buttons.
+// The query is reduced to its search terms, which the navigation buttons carry.
+func (p *Processor) sendSearch(ctx context.Context, chatID int, userID int64, query string) (err error) {
+	defer func() { err = e.WrapIfErr("cannot do command: search", err) }()
+
+	terms := strings.Join(storage.SearchTerms(query), " ")
+	if terms == "" {
+		return p.tg.SendMessage(ctx, chatID, fmt.Sprintf(msgNothingFound, query))
+	}
+
+	if len(terms) > maxSearchQuery {
+		return p.tg.SendMessage(ctx, chatID, msgQueryTooLong)
+	}
+
+	return p.sendListView(ctx, chatID, userID, searchView(terms))
+}
+
+// tagPage adds tags to the unread page listed under number nArg in /list
+// and replies with every tag the page has.
+func (p *Processor) tagPage(ctx context.Context, chatID int, userID int64, nArg string, tagArgs []string) (err error) {
+	defer func() { err = e.WrapIfErr("cannot do command: tag", err) }()
+
+	n, err := strconv.Atoi(nArg)
+	if err != nil || n < 1 {
+		return p.tg.SendMessage(ctx, chatID, fmt.Sprintf(msgNoListedPage, nArg))
+	}
+
+	tags := make([]string, len(tagArgs))
+
+	for i, arg := range tagArgs {
+		tag, ok := parseTag(arg)
+		if !ok {
+			return p.tg.SendMessage(ctx, chatID, msgInvalidTag)
+		}
+
+		tags[i] = tag
+	}
+
+	// Numbers follow /list, which shows unread pages newest first.
+	pages, err := p.storage.List(ctx, userID, unreadView.filter, n-1, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		return p.tg.SendMessage(ctx, chatID, fmt.Sprintf(msgNoListedPage, nArg))
+	}
+
+	page := pages[0]
+
+	if err := p.storage.AddTags(ctx, page, tags); err != nil {
+		return err
+	}
+
+	return p.tg.SendMessage(ctx, chatID, fmt.Sprintf(msgTagged, page.URL, formatTags(page.Tags)))
+}
+
+// sendTags sends the user's tags with the number of pages carrying each, most used first.
+func (p *Processor) sendTags(ctx context.Context, chatID int, userID int64) (err error) {
+	defer func() { err = e.WrapIfErr("cannot do command: tags", err) }()
+
+	tags, err := p.storage.Tags(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return p.tg.SendMessage(ctx, chatID, msgNoTags)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(msgTagsHeader)
+
+	for _, t := range tags {
+		fmt.Fprintf(&b, "\n%s%s — %d", tagPrefix, t.Name, t.Pages)
+	}
+
+	return p.tg.SendMessage(ctx, chatID, b.String())
+}
+
+// sendExport sends every page of the user as a file in the named format, html by default.
+func (p *Processor) sendExport(ctx context.Context, chatID int, userID int64, formatArg string) (err error) {
+	defer func() { err = e.WrapIfErr("cannot do command: export", err) }()
+
+	format, err := exchange.ParseFormat(formatArg)
+	if errors.Is(err, exchange.ErrUnknownFormat) {
+		return p.tg.SendMessage(ctx, chatID, msgUnknownFormat)
+	}
+
+	pages, err := exchange.LoadPages(ctx, p.storage, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		return p.tg.SendMessage(ctx, chatID, msgExportEmpty)
+	}
+
+	var b bytes.Buffer
+
+	if err := exchange.Export(&b, format, pages); err != nil {
+		return err
+	}
+
+	return p.tg.SendDocument(ctx, chatID, events.Document{
+		Name:    format.FileName(),
+		Data:    b.Bytes(),
+		Caption: fmt.Sprintf(msgExported, len(pages)),
+	})
+}
+
+// sendListView sends the first page of the given view.
+func (p *Processor) sendListView(ctx context.Context, chatID int, userID int64, view listView) error {
+	text, kb, err := p.renderList(ctx, userID, view, 0)
+	if err != nil {
+		return err
+	}
+
+	return p.tg.SendKeyboard(ctx, chatID, text, kb)
+}
+
+// sendHelp sends the list of commands to the user, or the details of
+// the named command if name is not empty.
+func (p *Processor) sendHelp(ctx context.Context, chatID int, name string) error {
+	if name == "" {
+		return p.tg.SendMessage(ctx, chatID, p.helpText())
+	}
+
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	cmd, ok := p.commands.lookup(name)
+	if !ok {
+		return p.tg.SendMessage(ctx, chatID, msgUnknownCommand)
+	}
+
+	return p.tg.SendMessage(ctx, chatID, commandHelp(cmd))
 }
 
 // sendHello sends the welcome message to the user.
-func (p *Processor) sendHello(chatID int) error {
-	return p.tg.SendMessage(chatID, msgHello)
+func (p *Processor) sendHello(ctx context.Context, chatID int) error {
+	return p.tg.SendMessage(ctx, chatID, msgHello+"\n\n"+p.helpText())
 }
 
-// NewMessageSender creates a closure function for sending messages to a specific chat.
-func NewMessageSender(
-	chatID int,
-	tg events.Client) func(string) error {
+// helpText lists the visible commands with their descriptions.
+func (p *Processor) helpText() string {
+	var b strings.Builder
 
-	return func(msg string) error {
-		return tg.SendMessage(chatID, msg)
+	b.WriteString(msgHelp)
+
+	for _, c := range p.commands.commands {
+		if !c.hidden {
+			fmt.Fprintf(&b, "\n%s — %s", c.usage(), c.description)
+		}
 	}
+
+	b.WriteString("\n\n")
+	b.WriteString(msgHelpDetails)
+
+	return b.String()
 }
 
-// isAddCmd checks if the text is a command to add a page (i.e., a URL).
-func isAddCmd(text string) bool {
-	return isURL(text)
+// commandHelp describes a single command: its syntax, description and aliases.
+func commandHelp(c *command) string {
+	res := c.usage() + "\n" + c.description
+
+	if len(c.aliases) > 0 {
+		res += "\n" + fmt.Sprintf(msgAliases, strings.Join(c.aliases, ", "))
+	}
+
+	return res
 }
 
-// isURL validates if the given text is a valid URL.
-func isURL(text string) bool {
-	u, err := url.Parse(text)
+// NewMessageSender creates a closure function for sending messages to a specific chat.
+func NewMessageSender(
+	ctx context.Context,
+	chatID int,
+	tg events.Client) func(string) error {
 
-	return err == nil && u.Host != ""
+	return func(msg string) error {
+		return tg.SendMessage(ctx, chatID, msg)
+	}
 }
@@ -0,0 +1,70 @@
+package tg_processor
+
+import (
+	"context"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"testing"
+)
+
+func TestRandomMarksRead(t *testing.T) {
+	ctx := context.Background()
+	store := files.New(t.TempDir())
+	tg := &fakeClient{}
+	p := New(tg, store, nil, "")
+	meta := Meta{ChatID: 1, UserID: 7}
+
+	page := &storage.Page{URL: "https://example.com/a", UserID: 7, Title: "Example"}
+	if err := store.Save(ctx, page); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	rnd := func(want string) {
+		t.Helper()
+
+		tg.sent, tg.kb = nil, nil
+
+		if err := p.doCmd(ctx, "/rnd", meta); err != nil {
+			t.Fatalf("doCmd: %v", err)
+		}
+
+		if len(tg.sent) != 1 || tg.sent[0] != want {
+			t.Fatalf("/rnd replied %q, want %q", tg.sent, want)
+		}
+	}
+
+	rnd("Example\nhttps://example.com/a")
+
+	putBack := events.Button{Text: msgPutBackButton, Data: "unread:" + page.ID}
+	if len(tg.kb) != 1 || len(tg.kb[0]) != 1 || tg.kb[0][0] != putBack {
+		t.Fatalf("keyboard = %v, want only %v", tg.kb, putBack)
+	}
+
+	// The page is archived, not removed.
+	if ok, err := store.Exists(ctx, page); err != nil || !ok {
+		t.Fatalf("Exists = %v, %v, want the page kept", ok, err)
+	}
+
+	read, err := store.List(ctx, 7, storage.Filter{State: storage.StateRead}, 0, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(read) != 1 || read[0].ID != page.ID || read[0].ReadAt.IsZero() {
+		t.Fatalf("read pages = %v, want the sent page", read)
+	}
+
+	rnd(msgNoSavedPages)
+
+	notice, err := p.doCallback(ctx, CallbackMeta{ChatID: 1, UserID: 7, Data: putBack.Data})
+	if err != nil {
+		t.Fatalf("doCallback: %v", err)
+	}
+
+	if notice != msgPutBack {
+		t.Errorf("notice = %q, want %q", notice, msgPutBack)
+	}
+
+	rnd("Example\nhttps://example.com/a")
+}
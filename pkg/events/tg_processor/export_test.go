@@ -0,0 +1,64 @@
+package tg_processor
+
+import (
+	"context"
+	"go_link_storage/pkg/storage/files"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	tg := &fakeClient{}
+	p := New(tg, files.New(t.TempDir()), nil, "")
+	meta := Meta{ChatID: 1, UserID: 7}
+
+	if err := p.doCmd(ctx, "/export", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if len(tg.sent) != 1 || tg.sent[0] != msgExportEmpty || len(tg.docs) != 0 {
+		t.Fatalf("export without pages replied %q and sent %d files", tg.sent, len(tg.docs))
+	}
+
+	if err := p.doCmd(ctx, "https://a.example #go", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	tests := []struct {
+		text string
+		name string
+		want string // Substring of the file
+	}{
+		{text: "/export", name: "links.html", want: `<A HREF="https://a.example/"`},
+		{text: "/export JSON", name: "links.json", want: `"tags": [`},
+		{text: "/export csv", name: "links.csv", want: "https://a.example/,,,,,go,"},
+	}
+
+	for _, tt := range tests {
+		tg.docs = nil
+
+		if err := p.doCmd(ctx, tt.text, meta); err != nil {
+			t.Fatalf("doCmd(%q): %v", tt.text, err)
+		}
+
+		if len(tg.docs) != 1 {
+			t.Fatalf("doCmd(%q) sent %d files, want 1", tt.text, len(tg.docs))
+		}
+
+		doc := tg.docs[0]
+		if doc.Name != tt.name || doc.Caption != "Pages: 1" || !strings.Contains(string(doc.Data), tt.want) {
+			t.Errorf("doCmd(%q) sent %s with caption %q:\n%s\nwant %s containing %q", tt.text, doc.Name, doc.Caption, doc.Data, tt.name, tt.want)
+		}
+	}
+
+	tg.sent = nil
+
+	if err := p.doCmd(ctx, "/export xml", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if len(tg.sent) != 1 || tg.sent[0] != msgUnknownFormat {
+		t.Errorf("export to an unknown format replied %q, want %q", tg.sent, msgUnknownFormat)
+	}
+}
@@ -0,0 +1,77 @@
+package tg_processor
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// trailingPunct is punctuation that ends a sentence rather than a link.
+const trailingPunct = ".,;:!?)"
+
+// extractLinks returns the web links of a message in the order they appear, without duplicates.
+// Links are taken from the url and text_link entities; a message without
+// entities, e.g. from a client that does not send them, is split into words
+// and every word that is a URL, minus trailing punctuation, is kept.
+func extractLinks(text string, entities []Entity) []string {
+	var res []string
+
+	add := func(link string) {
+		if isWebURL(link) && !slices.Contains(res, link) {
+			res = append(res, link)
+		}
+	}
+
+	if len(entities) == 0 {
+		for _, word := range strings.Fields(text) {
+			add(strings.TrimRight(word, trailingPunct))
+		}
+
+		return res
+	}
+
+	var units []uint16 // The text in UTF-16, which entity offsets are counted in
+
+	for _, ent := range entities {
+		switch ent.Type {
+		case EntityURL:
+			if units == nil {
+				units = utf16.Encode([]rune(text))
+			}
+
+			add(withScheme(utf16Slice(units, ent.Offset, ent.Length)))
+		case EntityTextLink:
+			add(ent.URL)
+		}
+	}
+
+	return res
+}
+
+// utf16Slice returns length code units of units starting at offset as a string.
+// Ranges outside units yield an empty string.
+func utf16Slice(units []uint16, offset, length int) string {
+	if offset < 0 || length < 0 || offset+length > len(units) {
+		return ""
+	}
+
+	return string(utf16.Decode(units[offset : offset+length]))
+}
+
+// isWebURL reports whether link is an absolute http or https URL.
+func isWebURL(link string) bool {
+	u, err := url.Parse(link)
+
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// withScheme prefixes a link without a scheme, like "example.com/a",
+// with http://, the way Telegram clients open such links.
+func withScheme(link string) string {
+	if link == "" || strings.Contains(link, "://") {
+		return link
+	}
+
+	return "http://" + link
+}
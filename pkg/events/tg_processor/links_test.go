@@ -0,0 +1,103 @@
+package tg_processor
+
+import (
+	"context"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"slices"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []Entity
+		want     []string
+	}{
+		{
+			name: "whole message without entities",
+			text: "https://example.com/a",
+			want: []string{"https://example.com/a"},
+		},
+		{
+			name: "words without entities",
+			text: "check this out https://x.y and ftp://files.example.com",
+			want: []string{"https://x.y"},
+		},
+		{
+			name: "url entities after emoji",
+			text: "🔥 https://a.example and example.com/b",
+			entities: []Entity{
+				{Type: EntityURL, Offset: 3, Length: 17},
+				{Type: EntityURL, Offset: 25, Length: 13},
+			},
+			want: []string{"https://a.example", "http://example.com/b"},
+		},
+		{
+			name: "text links and duplicates",
+			text: "read this and this and https://c.example",
+			entities: []Entity{
+				{Type: EntityTextLink, Offset: 5, Length: 4, URL: "https://c.example"},
+				{Type: "bold", Offset: 0, Length: 4},
+				{Type: EntityTextLink, Offset: 14, Length: 4, URL: "mailto:me@example.com"},
+				{Type: EntityURL, Offset: 23, Length: 17},
+			},
+			want: []string{"https://c.example"},
+		},
+		{
+			name:     "entity out of range",
+			text:     "short",
+			entities: []Entity{{Type: EntityURL, Offset: 2, Length: 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractLinks(tt.text, tt.entities); !slices.Equal(got, tt.want) {
+				t.Errorf("extractLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveLinksSummary(t *testing.T) {
+	ctx := context.Background()
+	tg := &fakeClient{}
+	previews := &fakePreviewer{}
+	p := New(tg, files.New(t.TempDir()), previews, "")
+	meta := Meta{ChatID: 1, UserID: 7, Username: "alice"}
+
+	if err := p.doCmd(ctx, "https://a.example", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if err := p.doCmd(ctx, "new https://b.example, old https://A.example/?utm_source=tg https://c.example", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	want := []string{
+		msgSaved,
+		"Saved 2 links:\n• https://b.example/\n• https://c.example/\n\nAlready saved, skipped 1:\n• https://a.example/",
+	}
+
+	if !slices.Equal(tg.sent, want) {
+		t.Errorf("replies = %q, want %q", tg.sent, want)
+	}
+
+	wantPreviews := []string{"https://a.example/", "https://b.example/", "https://c.example/"}
+
+	if !slices.Equal(previews.urls, wantPreviews) {
+		t.Errorf("previews = %q, want %q", previews.urls, wantPreviews)
+	}
+}
+
+// fakePreviewer records the URLs of the pages enqueued for previews.
+type fakePreviewer struct {
+	urls []string
+}
+
+// Enqueue implements Previewer.
+func (f *fakePreviewer) Enqueue(p *storage.Page) {
+	f.urls = append(f.urls, p.URL)
+}
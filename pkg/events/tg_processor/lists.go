@@ -0,0 +1,160 @@
+package tg_processor
+
+import (
+	"context"
+	"fmt"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/storage"
+	"strconv"
+	"strings"
+)
+
+const (
+	listPageSize  = 10 // Number of pages shown per list message
+	putBackPerRow = 5  // Number of put back buttons per keyboard row
+)
+
+// listView describes a paginated listing of the user's pages.
+type listView struct {
+	filter  storage.Filter // Pages shown in the view
+	query   string         // Search query the pages match, if the view lists search results
+	header  string         // Header format, takes the query of search views and the one-based page number
+	empty   string         // Text shown when the view has no pages at all
+	prefix  string         // Callback data prefix of the navigation buttons
+	putBack bool           // Whether every listed page gets a put back button
+}
+
+var (
+	// unreadView is the /list view of pages that have not been read yet.
+	unreadView = listView{
+		filter: storage.Filter{State: storage.StateUnread},
+		header: msgListHeader,
+		empty:  msgNoSavedPages,
+		prefix: listCallbackPrefix,
+	}
+	// archiveView is the /archive view of pages that have been read.
+	archiveView = listView{
+		filter:  storage.Filter{State: storage.StateRead},
+		header:  msgArchiveHeader,
+		empty:   msgArchiveEmpty,
+		prefix:  archiveCallbackPrefix,
+		putBack: true,
+	}
+)
+
+// searchView is the /search view of the pages matching query, best matches first.
+func searchView(query string) listView {
+	return listView{
+		query:  query,
+		header: msgSearchHeader,
+		empty:  fmt.Sprintf(msgNothingFound, query),
+		prefix: searchCallbackPrefix,
+	}
+}
+
+// renderList builds the text and keyboard for the given zero-based page
+// of the view: newest pages first, or best matches first for search views.
+func (p *Processor) renderList(ctx context.Context, userID int64, view listView, page int) (string, events.Keyboard, error) {
+	// One extra page is requested to find out whether a next page exists.
+	pages, err := p.listPages(ctx, userID, view, page*listPageSize, listPageSize+1)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(pages) == 0 {
+		if page == 0 {
+			return view.empty, nil, nil
+		}
+
+		return msgListEnd, events.Keyboard{{view.navButton(msgPrevPage, 0)}}, nil
+	}
+
+	hasNext := len(pages) > listPageSize
+	if hasNext {
+		pages = pages[:listPageSize]
+	}
+
+	var (
+		b       strings.Builder
+		kb      events.Keyboard
+		putBack []events.Button
+	)
+
+	b.WriteString(view.heading(page))
+
+	for i, pg := range pages {
+		n := page*listPageSize + i + 1
+
+		fmt.Fprintf(&b, "\n\n%d. ", n)
+
+		if pg.Title != "" {
+			b.WriteString(pg.Title + "\n")
+		}
+
+		b.WriteString(pg.URL)
+
+		if len(pg.Tags) > 0 {
+			b.WriteString("\n" + formatTags(pg.Tags))
+		}
+
+		if src := sourceLine(pg); src != "" {
+			b.WriteString("\n" + src)
+		}
+
+		if view.putBack {
+			putBack = append(putBack, events.Button{
+				Text: fmt.Sprintf(msgRestoreButton, n),
+				Data: restoreCallbackPrefix + strconv.Itoa(page) + callbackArgSep + pg.ID,
+			})
+		}
+	}
+
+	for len(putBack) > 0 {
+		row := putBack[:min(putBackPerRow, len(putBack))]
+		kb = append(kb, row)
+		putBack = putBack[len(row):]
+	}
+
+	var nav []events.Button
+	if page > 0 {
+		nav = append(nav, view.navButton(msgPrevPage, page-1))
+	}
+	if hasNext {
+		nav = append(nav, view.navButton(msgNextPage, page+1))
+	}
+
+	if len(nav) > 0 {
+		kb = append(kb, nav)
+	}
+
+	return b.String(), kb, nil
+}
+
+// listPages returns up to limit pages of the view, skipping the first offset pages.
+func (p *Processor) listPages(ctx context.Context, userID int64, view listView, offset, limit int) ([]*storage.Page, error) {
+	if view.query != "" {
+		return p.storage.Search(ctx, userID, view.query, offset, limit)
+	}
+
+	return p.storage.List(ctx, userID, view.filter, offset, limit)
+}
+
+// heading formats the header of the given zero-based page of the view.
+func (v listView) heading(page int) string {
+	if v.query != "" {
+		return fmt.Sprintf(v.header, v.query, page+1)
+	}
+
+	return fmt.Sprintf(v.header, page+1)
+}
+
+// navButton creates a button that opens the given page of the view.
+// Buttons of search views carry the query after the page.
+func (v listView) navButton(text string, page int) events.Button {
+	data := v.prefix + strconv.Itoa(page)
+	if v.query != "" {
+		data += callbackArgSep + v.query
+	}
+
+	return events.Button{Text: text, Data: data}
+}
@@ -0,0 +1,276 @@
+package tg_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	store := files.New(t.TempDir())
+
+	for i := range listPageSize + 1 {
+		p := &storage.Page{URL: fmt.Sprintf("https://example.com/%d", i), UserID: 7, Title: "Golang notes"}
+		if err := store.Save(ctx, p); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	tg := &fakeClient{}
+	p := New(tg, store, nil, "")
+	meta := Meta{ChatID: 1, UserID: 7}
+
+	if err := p.doCmd(ctx, `/search "GO,"`, meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if want := `Results for "go", page 1:`; len(tg.sent) != 1 || !strings.HasPrefix(tg.sent[0], want) {
+		t.Fatalf("replies = %q, want a reply starting with %q", tg.sent, want)
+	}
+
+	next := events.Button{Text: msgNextPage, Data: "search:1:go"}
+	if len(tg.kb) != 1 || len(tg.kb[0]) != 1 || tg.kb[0][0] != next {
+		t.Fatalf("keyboard = %v, want only %v", tg.kb, next)
+	}
+
+	cb := CallbackMeta{ChatID: 1, UserID: 7, Data: next.Data}
+	if _, err := p.doCallback(ctx, cb); err != nil {
+		t.Fatalf("doCallback: %v", err)
+	}
+
+	if want := `Results for "go", page 2:` + "\n\n11. Golang notes"; len(tg.sent) != 2 || !strings.HasPrefix(tg.sent[1], want) {
+		t.Fatalf("replies = %q, want the second one starting with %q", tg.sent, want)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "/search rust", want: `Nothing found for "rust"`},
+		{text: "/search ?!", want: `Nothing found for "?!"`},
+		{text: "/search " + strings.Repeat("golang ", 10), want: msgQueryTooLong},
+		{text: "/search", want: "Usage: /search <query...>"},
+	}
+
+	for _, tt := range tests {
+		tg.sent = nil
+
+		if err := p.doCmd(ctx, tt.text, meta); err != nil {
+			t.Fatalf("doCmd(%q): %v", tt.text, err)
+		}
+
+		if len(tg.sent) != 1 || tg.sent[0] != tt.want {
+			t.Errorf("doCmd(%q) replied %q, want %q", tt.text, tg.sent, tt.want)
+		}
+	}
+}
+
+// savePages saves a page https://example.com/<i> for every i in [0, n) for the user.
+// Later pages are saved later, so /list shows them first.
+func savePages(t *testing.T, store storage.Storage, userID int64, n int) []*storage.Page {
+	t.Helper()
+
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	pages := make([]*storage.Page, 0, n)
+
+	for i := range n {
+		p := &storage.Page{
+			URL:     fmt.Sprintf("https://example.com/%d", i),
+			UserID:  userID,
+			SavedAt: base.Add(time.Duration(i) * time.Minute),
+		}
+
+		if err := store.Save(context.Background(), p); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		pages = append(pages, p)
+	}
+
+	return pages
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	store := files.New(t.TempDir())
+	tg := &fakeClient{}
+	p := New(tg, store, nil, "")
+	meta := Meta{ChatID: 1, UserID: 7}
+
+	if err := p.doCmd(ctx, "/list", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if len(tg.sent) != 1 || tg.sent[0] != msgNoSavedPages || tg.kb != nil {
+		t.Fatalf("empty /list replied %q with %v, want %q without buttons", tg.sent, tg.kb, msgNoSavedPages)
+	}
+
+	pages := savePages(t, store, 7, listPageSize+2)
+
+	// Read pages are not listed, so 11 of the 12 pages are.
+	if err := store.SetReadAt(ctx, pages[5], time.Now()); err != nil {
+		t.Fatalf("SetReadAt: %v", err)
+	}
+
+	// Pages of other users are not listed either.
+	savePages(t, store, 8, 1)
+
+	steps := []struct {
+		name    string
+		data    string // Callback data of the pressed button; /list is sent if empty
+		want    string // Prefix of the message text
+		wantHas string // Substring of the message text
+		wantNot string // Text the message must not contain
+		wantNav []events.Button
+	}{
+		{
+			name:    "first page",
+			want:    "Your unread pages, page 1:\n\n1. https://example.com/11\n\n2. https://example.com/10",
+			wantHas: "10. https://example.com/1",
+			wantNot: "https://example.com/5",
+			wantNav: []events.Button{{Text: msgNextPage, Data: "list:1"}},
+		},
+		{
+			name:    "second page",
+			data:    "list:1",
+			want:    "Your unread pages, page 2:\n\n11. https://example.com/0",
+			wantNot: "\n\n12.",
+			wantNav: []events.Button{{Text: msgPrevPage, Data: "list:0"}},
+		},
+		{
+			name:    "past the end",
+			data:    "list:2",
+			want:    msgListEnd,
+			wantNav: []events.Button{{Text: msgPrevPage, Data: "list:0"}},
+		},
+		{
+			name:    "back to the first page",
+			data:    "list:0",
+			want:    "Your unread pages, page 1:",
+			wantNav: []events.Button{{Text: msgNextPage, Data: "list:1"}},
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			tg.sent, tg.kb = nil, nil
+
+			if step.data == "" {
+				if err := p.doCmd(ctx, "/list", meta); err != nil {
+					t.Fatalf("doCmd: %v", err)
+				}
+			} else if _, err := p.doCallback(ctx, CallbackMeta{ChatID: 1, MessageID: 3, UserID: 7, Data: step.data}); err != nil {
+				t.Fatalf("doCallback(%q): %v", step.data, err)
+			}
+
+			if len(tg.sent) != 1 || !strings.HasPrefix(tg.sent[0], step.want) {
+				t.Fatalf("replies = %q, want one starting with %q", tg.sent, step.want)
+			}
+
+			if !strings.Contains(tg.sent[0], step.wantHas) {
+				t.Errorf("reply %q does not contain %q", tg.sent[0], step.wantHas)
+			}
+
+			if step.wantNot != "" && strings.Contains(tg.sent[0], step.wantNot) {
+				t.Errorf("reply %q contains %q", tg.sent[0], step.wantNot)
+			}
+
+			if len(tg.kb) != 1 || !slices.Equal(tg.kb[0], step.wantNav) {
+				t.Errorf("keyboard = %v, want %v", tg.kb, step.wantNav)
+			}
+		})
+	}
+
+	for _, data := range []string{"list:x", "list:-1", "list:"} {
+		if _, err := p.doCallback(ctx, CallbackMeta{ChatID: 1, UserID: 7, Data: data}); !errors.Is(err, ErrUnknownCallback) {
+			t.Errorf("doCallback(%q) error = %v, want %v", data, err, ErrUnknownCallback)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	store := files.New(t.TempDir())
+	tg := &fakeClient{}
+	p := New(tg, store, nil, "")
+	meta := Meta{ChatID: 1, UserID: 7}
+
+	if err := p.doCmd(ctx, "/archive", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if len(tg.sent) != 1 || tg.sent[0] != msgArchiveEmpty {
+		t.Fatalf("empty /archive replied %q, want %q", tg.sent, msgArchiveEmpty)
+	}
+
+	pages := savePages(t, store, 7, 3)
+
+	for _, pg := range pages[1:] {
+		if err := store.SetReadAt(ctx, pg, time.Now()); err != nil {
+			t.Fatalf("SetReadAt: %v", err)
+		}
+	}
+
+	tg.sent = nil
+
+	if err := p.doCmd(ctx, "/archive", meta); err != nil {
+		t.Fatalf("doCmd: %v", err)
+	}
+
+	if want := "Your read pages, page 1:\n\n1. https://example.com/2\n\n2. https://example.com/1"; len(tg.sent) != 1 || tg.sent[0] != want {
+		t.Fatalf("/archive replied %q, want %q", tg.sent, want)
+	}
+
+	restore := []events.Button{
+		{Text: "↩ 1", Data: "restore:0:" + pages[2].ID},
+		{Text: "↩ 2", Data: "restore:0:" + pages[1].ID},
+	}
+	if len(tg.kb) != 1 || !slices.Equal(tg.kb[0], restore) {
+		t.Fatalf("keyboard = %v, want %v", tg.kb, restore)
+	}
+
+	// Putting a page back refreshes the archive message without it.
+	tg.sent = nil
+
+	notice, err := p.doCallback(ctx, CallbackMeta{ChatID: 1, MessageID: 3, UserID: 7, Data: restore[0].Data})
+	if err != nil {
+		t.Fatalf("doCallback: %v", err)
+	}
+
+	if notice != msgPutBack {
+		t.Errorf("notice = %q, want %q", notice, msgPutBack)
+	}
+
+	if want := "Your read pages, page 1:\n\n1. https://example.com/1"; len(tg.sent) != 1 || tg.sent[0] != want {
+		t.Fatalf("archive edited to %q, want %q", tg.sent, want)
+	}
+
+	unread, err := store.List(ctx, 7, storage.Filter{State: storage.StateUnread}, 0, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(unread) != 2 || unread[0].ID != pages[2].ID {
+		t.Errorf("unread pages = %v, want the restored page first", unread)
+	}
+
+	// Buttons of other users' messages or of removed pages do nothing.
+	for _, cb := range []CallbackMeta{
+		{ChatID: 1, UserID: 8, Data: restore[1].Data},
+		{ChatID: 1, UserID: 7, Data: "restore:0:nope"},
+		{ChatID: 1, UserID: 7, Data: "restore:" + pages[1].ID},
+		{ChatID: 1, UserID: 7, Data: "archive:x"},
+	} {
+		if _, err := p.doCallback(ctx, cb); !errors.Is(err, ErrUnknownCallback) {
+			t.Errorf("doCallback(%q) by user %d error = %v, want %v", cb.Data, cb.UserID, err, ErrUnknownCallback)
+		}
+	}
+}
@@ -1,10 +1,40 @@
 package tg_processor
 
 const (
-	msgHelp           = `This is starting help text`  // Help message text
-	msgHello          = `Hi there! \n\n` + msgHelp    // Welcome message text
-	msgUnknownCommand = `Command is unknown`          // Unknown command error message
-	msgNoSavedPages   = `You have no saved pages`     // No saved pages message
-	msgSaved          = `Saved!`                      // Page saved confirmation message
-	msgAlreadyExists  = `Page has been already saved` // Page already exists message
+	msgHelp           = "Send me a link and I will save it for later.\n\nCommands:" // Help text preceding the generated command list
+	msgHelpDetails    = `Send /help <command> to learn more about a command.`       // Help text following the command list
+	msgHello          = `Hi there!`                                                 // Welcome message, followed by the help text
+	msgUnknownCommand = `Command is unknown`                                        // Unknown command error message
+	msgUsage          = `Usage: %s`                                                 // Wrong arguments, formatted with the command syntax
+	msgAliases        = `Also available as %s`                                      // Command aliases, formatted with the list of aliases
+	msgUnclosedQuote  = `A quote in the command is not closed`                      // Command arguments with an unclosed quote
+	msgNoSavedPages   = `You have no unread pages`                                  // No saved pages message
+	msgSaved          = `Saved!`                                                    // Page saved confirmation message
+	msgSavedLinks     = `Saved %d links:`                                           // Summary of saved links, formatted with their number
+	msgSkippedLinks   = `Already saved, skipped %d:`                                // Summary of duplicate links, formatted with their number
+	msgSource         = `From %s`                                                   // Where a saved page came from, formatted with the source
+	msgAlreadyExists  = `Page has been already saved`                               // Page already exists message
+	msgListHeader     = `Your unread pages, page %d:`                               // /list header, formatted with the page number
+	msgArchiveHeader  = `Your read pages, page %d:`                                 // /archive header, formatted with the page number
+	msgArchiveEmpty   = `You have no read pages`                                    // /archive with nothing read yet
+	msgSearchHeader   = `Results for "%s", page %d:`                                // /search header, formatted with the query and the page number
+	msgNothingFound   = `Nothing found for "%s"`                                    // /search without results, formatted with the query
+	msgQueryTooLong   = `The search query is too long, try fewer words`             // /search query that does not fit into the navigation buttons
+	msgTagsHeader     = `Your tags:`                                                // /tags header, followed by the tags with page counts
+	msgNoTags         = `You have no tagged pages`                                  // /tags with no tagged pages
+	msgTagged         = `Tags of %s: %s`                                            // /tag confirmation, formatted with the URL and every tag of the page
+	msgInvalidTag     = `Tags may only contain letters, digits and underscores`     // Tag argument that is not a valid tag
+	msgNoListedPage   = `There is no page %s in /list`                              // /tag number that matches no unread page
+	msgNoTaggedPages  = `You have no unread pages tagged %s`                        // /rnd with a tag no unread page has
+	msgUnknownFormat  = `Unknown format, use html, json or csv`                     // /export with an unsupported format
+	msgExportEmpty    = `You have no saved pages to export`                         // /export without pages
+	msgExported       = `Pages: %d`                                                 // /export file caption, formatted with the number of pages
+	msgListEnd        = `There are no more pages`                                   // List page past the last one
+	msgPrevPage       = `« Prev`                                                    // Previous page button label
+	msgNextPage       = `Next »`                                                    // Next page button label
+	msgPutBackButton  = `↩ Put back`                                                // Button returning a page to the unread pool
+	msgRestoreButton  = `↩ %d`                                                      // /archive button returning the numbered page to the unread pool
+	msgPutBack        = `The page is back in your list`                             // Page returned to the unread pool
+	msgUnknownAction  = `This button is no longer valid`                            // Callback data matches no action or page
+	msgActionFailed   = `Something went wrong, try again`                           // Callback action failed
 )
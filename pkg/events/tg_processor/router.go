@@ -0,0 +1,209 @@
+package tg_processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/events"
+	"strings"
+	"unicode"
+)
+
+// arg describes an argument accepted by a command.
+type arg struct {
+	name     string // Name shown in the usage line
+	optional bool   // Whether the argument may be omitted
+	rest     bool   // Whether the argument takes every remaining word; only the last one may
+}
+
+// command describes a bot command.
+type command struct {
+	name        string                                       // Name with the leading slash, e.g. "/rnd"
+	aliases     []string                                     // Alternative names with the leading slash
+	description string                                       // One-line description for /help and the command menu
+	args        []arg                                        // Accepted arguments, in order
+	hidden      bool                                         // Whether the command is left out of /help and the menu
+	handler     func(ctx context.Context, req request) error // Runs the command
+}
+
+// request is a parsed command invocation.
+type request struct {
+	chatID int      // Chat the command was sent to
+	userID int64    // Telegram ID of the sender
+	args   []string // Arguments, validated against the command's schema
+}
+
+// arg returns the i-th argument or an empty string if it was omitted.
+func (r request) arg(i int) string {
+	if i < len(r.args) {
+		return r.args[i]
+	}
+
+	return ""
+}
+
+// usage returns the command syntax, e.g. "/help [command]".
+func (c *command) usage() string {
+	var b strings.Builder
+
+	b.WriteString(c.name)
+
+	for _, a := range c.args {
+		name := a.name
+		if a.rest {
+			name += "..."
+		}
+
+		if a.optional {
+			fmt.Fprintf(&b, " [%s]", name)
+		} else {
+			fmt.Fprintf(&b, " <%s>", name)
+		}
+	}
+
+	return b.String()
+}
+
+// accepts reports whether n arguments match the command's schema.
+func (c *command) accepts(n int) bool {
+	required := 0
+	for _, a := range c.args {
+		if !a.optional {
+			required++
+		}
+	}
+
+	if n < required {
+		return false
+	}
+
+	return n <= len(c.args) || (len(c.args) > 0 && c.args[len(c.args)-1].rest)
+}
+
+// router dispatches command messages to the registered commands.
+type router struct {
+	botName  string              // Username of the bot; empty accepts commands addressed to any bot
+	commands []*command          // Commands in registration order
+	byName   map[string]*command // Commands by name and alias
+}
+
+// newRouter registers cmds for the bot with the given username.
+// Names and aliases must be unique.
+func newRouter(botName string, cmds ...*command) *router {
+	r := &router{
+		botName:  botName,
+		commands: cmds,
+		byName:   make(map[string]*command),
+	}
+
+	for _, c := range cmds {
+		for _, name := range append([]string{c.name}, c.aliases...) {
+			if _, ok := r.byName[name]; ok {
+				panic("tg_processor: command " + name + " registered twice")
+			}
+
+			r.byName[name] = c
+		}
+	}
+
+	return r
+}
+
+// lookup returns the command registered under name or alias.
+func (r *router) lookup(name string) (*command, bool) {
+	c, ok := r.byName[strings.ToLower(name)]
+
+	return c, ok
+}
+
+// addressedTo reports whether a command with the given @username suffix is
+// meant for this bot. Commands without a suffix are meant for every bot in the chat.
+func (r *router) addressedTo(bot string) bool {
+	return bot == "" || r.botName == "" || strings.EqualFold(bot, r.botName)
+}
+
+// menu returns the visible commands in the form of the Telegram command menu.
+func (r *router) menu() []events.Command {
+	res := make([]events.Command, 0, len(r.commands))
+
+	for _, c := range r.commands {
+		if !c.hidden {
+			res = append(res, events.Command{
+				Name:        strings.TrimPrefix(c.name, "/"),
+				Description: c.description,
+			})
+		}
+	}
+
+	return res
+}
+
+// errUnclosedQuote is returned by splitArgs when a quoted argument is not closed.
+var errUnclosedQuote = errors.New("unclosed quote")
+
+// parseCommand splits a command message into the command name, the username
+// of the bot it is addressed to and its arguments. The name is lowercased and
+// the @username suffix used in group chats is split off, so "/Rnd@MyBot"
+// becomes "/rnd" addressed to "MyBot". The name and the bot are returned
+// even if the arguments cannot be split.
+func parseCommand(text string) (name string, bot string, args []string, err error) {
+	name, rest := strings.TrimSpace(text), ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	name, bot, _ = strings.Cut(name, "@")
+	args, err = splitArgs(rest)
+
+	return strings.ToLower(name), bot, args, err
+}
+
+// splitArgs splits s into whitespace-separated words. Text in double quotes,
+// straight or typographic, is kept as one argument, and a backslash
+// makes the next character literal.
+func splitArgs(s string) ([]string, error) {
+	var (
+		res     []string
+		cur     strings.Builder
+		inWord  bool // Whether cur holds an argument, possibly an empty quoted one
+		closing rune // Quote that closes the current quoted text, 0 outside quotes
+		escaped bool // Whether the previous character was a backslash
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inWord = true, true
+		case closing != 0 && r == closing:
+			closing = 0
+		case closing != 0:
+			cur.WriteRune(r)
+		case r == '"':
+			closing, inWord = '"', true
+		case r == '“':
+			closing, inWord = '”', true
+		case unicode.IsSpace(r):
+			if inWord {
+				res = append(res, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if closing != 0 {
+		return nil, errUnclosedQuote
+	}
+
+	if inWord {
+		res = append(res, cur.String())
+	}
+
+	return res, nil
+}
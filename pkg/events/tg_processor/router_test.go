@@ -0,0 +1,166 @@
+package tg_processor
+
+import (
+	"context"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/storage/files"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantBot  string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{text: "/rnd", wantName: "/rnd"},
+		{text: "/Rnd@MyLinkBot", wantName: "/rnd", wantBot: "MyLinkBot"},
+		{text: "/help@MyLinkBot list", wantName: "/help", wantBot: "MyLinkBot", wantArgs: []string{"list"}},
+		{text: "/help extra", wantName: "/help", wantArgs: []string{"extra"}},
+		{text: "/tag 12  go\tnews", wantName: "/tag", wantArgs: []string{"12", "go", "news"}},
+		{text: `/search "two words" one`, wantName: "/search", wantArgs: []string{"two words", "one"}},
+		{text: `/search “smart quotes”`, wantName: "/search", wantArgs: []string{"smart quotes"}},
+		{text: `/note 1 "say \"hi\"" a\ b ""`, wantName: "/note", wantArgs: []string{"1", `say "hi"`, "a b", ""}},
+		{text: `/search "open`, wantName: "/search", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			name, bot, args, err := parseCommand(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if name != tt.wantName || bot != tt.wantBot || !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("parseCommand() = %q, %q, %q, want %q, %q, %q", name, bot, args, tt.wantName, tt.wantBot, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// fakeClient records the messages sent through it.
+type fakeClient struct {
+	sent    []string
+	kb      events.Keyboard // Keyboard of the last message sent or edited
+	docs    []events.Document
+	menu    []events.Command
+	answers []answer // Answered callback queries
+	editErr error    // Returned by EditKeyboard
+}
+
+// answer is an answered callback query.
+type answer struct {
+	queryID string
+	text    string
+}
+
+func (c *fakeClient) SendMessage(_ context.Context, _ int, text string) error {
+	c.sent = append(c.sent, text)
+	return nil
+}
+
+func (c *fakeClient) SendKeyboard(_ context.Context, _ int, text string, kb events.Keyboard) error {
+	c.sent = append(c.sent, text)
+	c.kb = kb
+	return nil
+}
+
+func (c *fakeClient) EditKeyboard(_ context.Context, _ int, _ int, text string, kb events.Keyboard) error {
+	if c.editErr != nil {
+		return c.editErr
+	}
+
+	c.sent = append(c.sent, text)
+	c.kb = kb
+	return nil
+}
+
+func (c *fakeClient) AnswerCallbackQuery(_ context.Context, queryID string, text string) error {
+	c.answers = append(c.answers, answer{queryID: queryID, text: text})
+	return nil
+}
+
+func (c *fakeClient) SendDocument(_ context.Context, _ int, doc events.Document) error {
+	c.docs = append(c.docs, doc)
+	return nil
+}
+
+func (c *fakeClient) BotUsername(context.Context) (string, error) {
+	return "MyLinkBot", nil
+}
+
+func (c *fakeClient) SetCommands(_ context.Context, commands []events.Command) error {
+	c.menu = commands
+	return nil
+}
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // Substring of the reply
+	}{
+		{text: "/help", want: ListCmd + " — "},
+		{text: "/help@MyLinkBot", want: ListCmd + " — "},
+		{text: "/help@mylinkbot", want: ListCmd + " — "},
+		{text: "/help archive", want: "Also available as /read"},
+		{text: "/help /rnd", want: "Also available as /random"},
+		{text: "/help nope", want: msgUnknownCommand},
+		{text: "/help a b", want: "Usage: /help [command]"},
+		{text: `/help "a`, want: msgUnclosedQuote},
+		{text: "/nope", want: msgUnknownCommand},
+		{text: "hello", want: msgUnknownCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			tg := &fakeClient{}
+			p := New(tg, nil, nil, "MyLinkBot")
+
+			if err := p.doCmd(context.Background(), tt.text, Meta{ChatID: 1, UserID: 7, Username: "alice"}); err != nil {
+				t.Fatalf("doCmd() error = %v", err)
+			}
+
+			if len(tg.sent) != 1 || !strings.Contains(tg.sent[0], tt.want) {
+				t.Errorf("doCmd() replied %q, want a reply containing %q", tg.sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCommandForOtherBot(t *testing.T) {
+	for _, text := range []string{"/rnd@otherbot", "/help@otherbot list", `/search@otherbot "open`, "/nope@otherbot"} {
+		t.Run(text, func(t *testing.T) {
+			tg := &fakeClient{}
+			p := New(tg, files.New(t.TempDir()), nil, "MyLinkBot")
+
+			if err := p.doCmd(context.Background(), text, Meta{ChatID: 1, UserID: 7, Username: "alice"}); err != nil {
+				t.Fatalf("doCmd() error = %v", err)
+			}
+
+			if len(tg.sent) != 0 {
+				t.Errorf("doCmd() replied %q to a command for another bot", tg.sent)
+			}
+		})
+	}
+}
+
+func TestPublishCommands(t *testing.T) {
+	tg := &fakeClient{}
+
+	if err := New(tg, nil, nil, "").PublishCommands(context.Background()); err != nil {
+		t.Fatalf("PublishCommands() error = %v", err)
+	}
+
+	var names []string
+	for _, c := range tg.menu {
+		names = append(names, c.Name)
+	}
+
+	if want := []string{"rnd", "list", "archive", "search", "tag", "tags", "export", "help"}; !slices.Equal(names, want) {
+		t.Errorf("menu = %q, want %q", names, want)
+	}
+}
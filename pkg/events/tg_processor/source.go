@@ -0,0 +1,81 @@
+package tg_processor
+
+import (
+	"fmt"
+	"go_link_storage/pkg/storage"
+	"strings"
+)
+
+// Source describes where a forwarded message was originally posted.
+// The zero Source means the message was not forwarded.
+type Source struct {
+	Name string // Title of the channel or chat, or the name of the user
+	URL  string // Link to the original message or chat, empty if it has none
+}
+
+// privateChannelBase is subtracted from the negated ID of a channel
+// to get the ID used in t.me/c/ links.
+const privateChannelBase = 1_000_000_000_000
+
+// ChannelSource describes a post forwarded from a channel.
+// Public channels are linked by username, private ones by ID; only members
+// of a private channel can open the link.
+func ChannelSource(chatID int64, title string, username string, messageID int) Source {
+	src := Source{Name: title}
+
+	switch id := -chatID - privateChannelBase; {
+	case username != "":
+		src.URL = fmt.Sprintf("https://t.me/%s/%d", username, messageID)
+	case id > 0:
+		src.URL = fmt.Sprintf("https://t.me/c/%d/%d", id, messageID)
+	}
+
+	if src.Name == "" && username != "" {
+		src.Name = "@" + username
+	}
+
+	return src
+}
+
+// ChatSource describes a message forwarded from a group sent on behalf of the group.
+// Only public groups are linked.
+func ChatSource(title string, username string) Source {
+	src := Source{Name: title}
+
+	if username != "" {
+		src.URL = "https://t.me/" + username
+	}
+
+	return src
+}
+
+// UserSource describes a message forwarded from a user. Only users with
+// a public username are linked.
+func UserSource(firstName string, lastName string, username string) Source {
+	src := Source{Name: strings.TrimSpace(firstName + " " + lastName)}
+
+	if username != "" {
+		src.URL = "https://t.me/" + username
+
+		if src.Name == "" {
+			src.Name = "@" + username
+		}
+	}
+
+	return src
+}
+
+// sourceLine tells where a saved page came from, or returns an empty string
+// for pages saved from the user's own messages.
+func sourceLine(p *storage.Page) string {
+	switch {
+	case p.SourceName == "" && p.SourceURL == "":
+		return ""
+	case p.SourceURL == "":
+		return fmt.Sprintf(msgSource, p.SourceName)
+	case p.SourceName == "":
+		return fmt.Sprintf(msgSource, p.SourceURL)
+	default:
+		return fmt.Sprintf(msgSource, p.SourceName+" ("+p.SourceURL+")")
+	}
+}
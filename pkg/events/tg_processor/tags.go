@@ -0,0 +1,64 @@
+package tg_processor
+
+import (
+	"go_link_storage/pkg/storage"
+	"strings"
+	"unicode"
+)
+
+// tagPrefix starts a hashtag in messages and marks tags in replies.
+const tagPrefix = "#"
+
+// extractTags returns the hashtags of a message, normalized and without duplicates.
+// A hashtag is a word starting with tagPrefix followed by a valid tag name;
+// trailing punctuation is dropped, so "#go," is the tag "go".
+func extractTags(text string) []string {
+	var tags []string
+
+	for _, word := range strings.Fields(text) {
+		tag, ok := strings.CutPrefix(strings.TrimRight(word, trailingPunct), tagPrefix)
+		if ok && isTag(tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return storage.NormalizeTags(tags)
+}
+
+// parseTag returns the normalized tag of a command argument, which may
+// start with tagPrefix. It reports false if the argument is not a valid tag.
+func parseTag(arg string) (string, bool) {
+	tag := strings.TrimPrefix(arg, tagPrefix)
+	if !isTag(tag) {
+		return "", false
+	}
+
+	return storage.NormalizeTag(tag), true
+}
+
+// isTag reports whether name is a valid tag name: letters, digits and
+// underscores, like Telegram hashtags.
+func isTag(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// formatTags formats tags as hashtags separated by spaces.
+func formatTags(tags []string) string {
+	res := make([]string, len(tags))
+
+	for i, tag := range tags {
+		res[i] = tagPrefix + tag
+	}
+
+	return strings.Join(res, " ")
+}
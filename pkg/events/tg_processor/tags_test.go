@@ -0,0 +1,66 @@
+package tg_processor
+
+import (
+	"context"
+	"go_link_storage/pkg/storage/files"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractTags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "https://x.y #go #Perf", want: []string{"go", "perf"}},
+		{text: "#go, #go. #GO!", want: []string{"go"}},
+		{text: "https://x.y/#frag a#b # #no-dash #snake_case #тест", want: []string{"snake_case", "тест"}},
+		{text: "no tags"},
+	}
+
+	for _, tt := range tests {
+		if got := extractTags(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("extractTags(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTagCommands(t *testing.T) {
+	ctx := context.Background()
+	tg := &fakeClient{}
+	p := New(tg, files.New(t.TempDir()), nil, "")
+	meta := Meta{ChatID: 1, UserID: 7}
+
+	steps := []struct {
+		text string
+		want string // Prefix of the reply
+	}{
+		{text: "/tags", want: msgNoTags},
+		{text: "https://a.example #go #perf", want: msgSaved},
+		{text: "https://b.example", want: msgSaved},
+		{text: "/tag 2 db", want: "Tags of https://a.example/: #db #go #perf"},
+		{text: "/tag 1 #Go", want: "Tags of https://b.example/: #go"},
+		{text: "/tag 3 go", want: "There is no page 3 in /list"},
+		{text: "/tag x go", want: "There is no page x in /list"},
+		{text: "/tag 1 c++", want: msgInvalidTag},
+		{text: "/tag 1", want: "Usage: /tag <n> <tag...>"},
+		{text: "/tags", want: "Your tags:\n#go — 2\n#db — 1\n#perf — 1"},
+		{text: "/rnd #db", want: "https://a.example/\n#db #go #perf"},
+		{text: "/rnd #db", want: "You have no unread pages tagged #db"},
+		{text: "/rnd #c++", want: msgInvalidTag},
+		{text: "/rnd go", want: "https://b.example/\n#go"},
+	}
+
+	for _, step := range steps {
+		tg.sent = nil
+
+		if err := p.doCmd(ctx, step.text, meta); err != nil {
+			t.Fatalf("doCmd(%q): %v", step.text, err)
+		}
+
+		if len(tg.sent) != 1 || !strings.HasPrefix(tg.sent[0], step.want) {
+			t.Fatalf("doCmd(%q) replied %q, want a reply starting with %q", step.text, tg.sent, step.want)
+		}
+	}
+}
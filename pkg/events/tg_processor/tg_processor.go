@@ -4,24 +4,80 @@
 package tg_processor
 
 import (
+	"context"
+	"encoding/gob"
 	"errors"
 	"go_link_storage/pkg/events"
 	"go_link_storage/pkg/lib/e"
 	"go_link_storage/pkg/storage"
+	"sync"
 )
 
 // Processor handles Telegram events by fetching updates and processing messages.
 // It implements both events.Fetcher and events.Processor interfaces.
 type Processor struct {
-	tg      events.Client   // Telegram API client
-	offset  int             // Offset for fetching updates
-	storage storage.Storage // Storage for saving pages
+	tg       events.Client   // Telegram API client
+	offset   int             // Offset for fetching updates
+	storage  storage.Storage // Storage for saving pages
+	previews Previewer       // Fetcher of previews of saved pages, may be nil
+	commands *router         // Registered bot commands
+	migrated sync.Map        // IDs of users whose username-keyed pages have been migrated
+}
+
+// Previewer fills in the previews of saved pages in the background.
+type Previewer interface {
+	// Enqueue schedules fetching the preview of a saved page. It must not block.
+	Enqueue(p *storage.Page)
 }
 
 // Meta contains metadata associated with Telegram events.
 type Meta struct {
-	ChatID   int    // Telegram chat ID
-	Username string // Telegram username
+	ChatID   int      // Telegram chat ID
+	UserID   int64    // Telegram ID of the sender, used to key their pages
+	Username string   // Telegram username, may be empty
+	Entities []Entity // Entities Telegram found in the message text
+	Source   Source   // Origin of a forwarded message
+}
+
+// Entity types the processor looks at.
+const (
+	EntityURL      = "url"       // Link written in the text
+	EntityTextLink = "text_link" // Text that links to Entity.URL
+)
+
+// Entity is a special part of a message text, such as a link or a hashtag.
+type Entity struct {
+	Type   string // Entity type, e.g. EntityURL
+	Offset int    // Start of the entity in UTF-16 code units
+	Length int    // Length of the entity in UTF-16 code units
+	URL    string // Target of an EntityTextLink
+}
+
+// CallbackMeta contains metadata associated with Telegram callback query events.
+type CallbackMeta struct {
+	QueryID   string // Callback query identifier used to answer it
+	ChatID    int    // Chat of the message the button is attached to
+	MessageID int    // Message the button is attached to
+	UserID    int64  // Telegram ID of the user who pressed the button
+	Username  string // Telegram username of the user who pressed the button
+	Data      string // Callback data of the button
+}
+
+// ChatKey implements events.ChatScoped.
+func (m Meta) ChatKey() int {
+	return m.ChatID
+}
+
+// ChatKey implements events.ChatScoped.
+func (m CallbackMeta) ChatKey() int {
+	return m.ChatID
+}
+
+// init registers the metadata types with gob, so events can be stored
+// as dead letters and decoded again.
+func init() {
+	gob.Register(Meta{})
+	gob.Register(CallbackMeta{})
 }
 
 var (
@@ -29,34 +85,50 @@ var (
 	ErrUnknownEventType = errors.New("unknown event type")
 	// ErrUnknownMetaType is returned when event metadata has an unexpected type.
 	ErrUnknownMetaType = errors.New("unknown meta type")
+	// ErrUnknownCallback is returned when callback data matches no known action.
+	ErrUnknownCallback = errors.New("unknown callback")
 )
 
 // New creates a new Telegram event processor with the given client and storage.
-func New(client events.Client, storage storage.Storage) *Processor {
-	return &Processor{
-		tg:      client,
-		storage: storage,
+// Saved pages are passed to previews, unless it is nil. botName is the username
+// of the bot: commands addressed to other bots, like "/rnd@otherbot", are ignored.
+// An empty botName accepts commands addressed to any bot.
+func New(client events.Client, storage storage.Storage, previews Previewer, botName string) *Processor {
+	p := &Processor{
+		tg:       client,
+		storage:  storage,
+		previews: previews,
 	}
+
+	p.commands = p.newCommands(botName)
+
+	return p
 }
 
 // Process handles an event by routing it to the appropriate handler based on event type.
-func (p *Processor) Process(event events.Event) error {
+func (p *Processor) Process(ctx context.Context, event events.Event) error {
 	switch event.Type {
 	case events.Message:
-		return p.processMessage(event)
+		return p.processMessage(ctx, event)
+	case events.CallbackQuery:
+		return p.processCallback(ctx, event)
 	default:
 		return e.Wrap("cannot process event", ErrUnknownEventType)
 	}
 }
 
 // processMessage handles message events by extracting metadata and executing commands.
-func (p *Processor) processMessage(event events.Event) error {
+func (p *Processor) processMessage(ctx context.Context, event events.Event) error {
 	meta, err := meta(event)
 	if err != nil {
 		return e.Wrap("cannot process message", err)
 	}
 
-	if err := p.doCmd(event.Text, meta.ChatID, meta.Username); err != nil {
+	if err := p.migrateUser(ctx, meta.UserID, meta.Username); err != nil {
+		return e.Wrap("cannot process message", err)
+	}
+
+	if err := p.doCmd(ctx, event.Text, meta); err != nil {
 		return e.Wrap("cannot process message", err)
 	}
 
@@ -72,3 +144,25 @@ func meta(event events.Event) (Meta, error) {
 
 	return res, nil
 }
+
+// migrateUser moves the pages older versions saved under the username to the
+// user ID the first time the user writes after an upgrade. Pages saved without
+// a username were shared by all such users and cannot be attributed, so they
+// are left alone.
+func (p *Processor) migrateUser(ctx context.Context, userID int64, username string) error {
+	if username == "" {
+		return nil
+	}
+
+	if _, ok := p.migrated.Load(userID); ok {
+		return nil
+	}
+
+	if err := p.storage.MigrateUser(ctx, username, userID); err != nil {
+		return e.Wrap("cannot migrate user", err)
+	}
+
+	p.migrated.Store(userID, struct{}{})
+
+	return nil
+}
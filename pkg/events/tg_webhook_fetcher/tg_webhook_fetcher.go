@@ -0,0 +1,165 @@
+// Package tg_webhook_fetcher receives Telegram updates through a webhook
+// instead of polling the Bot API.
+package tg_webhook_fetcher
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"go_link_storage/pkg/clients/tg_custom_client"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/events/tg_custom_fetcher"
+	"go_link_storage/pkg/lib/e"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// SecretHeader carries the secret token Telegram was given in setWebhook.
+	SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	maxUpdateSize = 1 << 20 // Largest accepted update body in bytes
+)
+
+// Config holds the webhook settings.
+type Config struct {
+	URL             string        // Public HTTPS URL Telegram posts updates to
+	ListenAddr      string        // Local address the HTTP server listens on
+	Path            string        // Request path updates are accepted on
+	Secret          string        // Secret token expected in SecretHeader
+	ShutdownTimeout time.Duration // Time allowed for in-flight requests and removing the webhook on shutdown
+}
+
+// webhookClient registers and removes the webhook; *tg_custom_client.Client implements it.
+type webhookClient interface {
+	SetWebhook(ctx context.Context, webhookURL string, secretToken string) error
+	DeleteWebhook(ctx context.Context) error
+}
+
+// Fetcher runs an HTTP server that receives updates pushed by Telegram.
+type Fetcher struct {
+	tg  webhookClient // Telegram API client used to manage the webhook
+	cfg Config        // Webhook settings
+}
+
+// New creates a new webhook fetcher with the given client and settings.
+func New(client *tg_custom_client.Client, cfg Config) *Fetcher {
+	return &Fetcher{
+		tg:  client,
+		cfg: cfg,
+	}
+}
+
+// Start registers the webhook and serves updates until ctx is canceled,
+// then stops the server, waiting for requests being handled, and removes the webhook.
+// Telegram pushes updates one at a time, so batchSize is not used.
+// Requests still being handled when cfg.ShutdownTimeout expires are abandoned,
+// so handleEventsCallback must cope with being called after Start returns.
+func (f *Fetcher) Start(ctx context.Context, handleEventsCallback func(events []events.Event) error, batchSize int) (err error) {
+	defer func() { err = e.WrapIfErr("webhook", err) }()
+
+	ln, err := net.Listen("tcp", f.cfg.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	return f.serve(ctx, ln, handleEventsCallback)
+}
+
+// serve registers the webhook and serves updates on ln until ctx is canceled.
+// ln is closed when serve returns.
+func (f *Fetcher) serve(ctx context.Context, ln net.Listener, handleEventsCallback func(events []events.Event) error) (err error) {
+	mux := http.NewServeMux()
+	mux.Handle(f.cfg.Path, f.Handler(handleEventsCallback))
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if err := f.tg.SetWebhook(ctx, f.cfg.URL, f.cfg.Secret); err != nil {
+		_ = ln.Close()
+		return err
+	}
+
+	defer func() {
+		// ctx is already canceled here, but the webhook still has to be removed.
+		delCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), f.cfg.ShutdownTimeout)
+		defer cancel()
+
+		if delErr := f.tg.DeleteWebhook(delCtx); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+	}()
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	log.Printf("webhook server listening on %s%s", ln.Addr(), f.cfg.Path)
+
+	select {
+	case err := <-serveErr:
+		return e.Wrap("server stopped", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), f.cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// Connections of the abandoned requests are closed forcibly.
+		_ = srv.Close()
+		return e.Wrap("cannot shut down server", err)
+	}
+
+	return nil
+}
+
+// Handler returns the HTTP handler that accepts updates posted by Telegram
+// and passes them to handleEventsCallback.
+// Requests without the expected secret token are rejected.
+func (f *Fetcher) Handler(handleEventsCallback func(events []events.Event) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		if !f.validSecret(r.Header.Get(SecretHeader)) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		var upd tg_custom_client.Update
+
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&upd); err != nil {
+			http.Error(w, "cannot decode update", http.StatusBadRequest)
+
+			return
+		}
+
+		// The update is only queued here; one that cannot be queued is redelivered by Telegram later.
+		if err := handleEventsCallback([]events.Event{tg_custom_fetcher.Event(upd)}); err != nil {
+			log.Printf("[ERR] webhook: cannot handle update %d: %s", upd.ID, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// validSecret compares the received secret token in constant time.
+func (f *Fetcher) validSecret(got string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(f.cfg.Secret)) == 1
+}
@@ -0,0 +1,195 @@
+package tg_webhook_fetcher
+
+import (
+	"context"
+	"go_link_storage/pkg/events"
+	"go_link_storage/pkg/events/tg_processor"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+func TestHandler(t *testing.T) {
+	const update = `{"update_id": 7, "message": {"message_id": 1, "text": "/rnd",
+		"from": {"id": 1001, "username": "alice"}, "chat": {"id": 42}}}`
+
+	tests := []struct {
+		name     string
+		method   string
+		secret   string
+		body     string
+		wantCode int
+		wantText string
+	}{
+		{"valid update", http.MethodPost, testSecret, update, http.StatusOK, "/rnd"},
+		{"wrong secret", http.MethodPost, "nope", update, http.StatusUnauthorized, ""},
+		{"missing secret", http.MethodPost, "", update, http.StatusUnauthorized, ""},
+		{"wrong method", http.MethodGet, testSecret, "", http.StatusMethodNotAllowed, ""},
+		{"malformed body", http.MethodPost, testSecret, "{", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []events.Event
+
+			f := New(nil, Config{Secret: testSecret})
+			srv := httptest.NewServer(f.Handler(func(evs []events.Event) error {
+				got = append(got, evs...)
+				return nil
+			}))
+			defer srv.Close()
+
+			req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+
+			if tt.secret != "" {
+				req.Header.Set(SecretHeader, tt.secret)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+
+			if tt.wantText == "" {
+				if len(got) != 0 {
+					t.Fatalf("rejected request produced events: %v", got)
+				}
+
+				return
+			}
+
+			if len(got) != 1 || got[0].Type != events.Message || got[0].Text != tt.wantText {
+				t.Fatalf("events = %+v, want one message %q", got, tt.wantText)
+			}
+
+			meta, ok := got[0].Meta.(tg_processor.Meta)
+			if !ok || meta.ChatID != 42 || meta.UserID != 1001 || meta.Username != "alice" {
+				t.Fatalf("meta = %+v, want chat 42 from user 1001 alice", got[0].Meta)
+			}
+		})
+	}
+}
+
+// fakeWebhookClient records webhook registration calls.
+type fakeWebhookClient struct {
+	mu      sync.Mutex
+	set     bool
+	deleted bool
+}
+
+func (c *fakeWebhookClient) SetWebhook(context.Context, string, string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set = true
+
+	return nil
+}
+
+func (c *fakeWebhookClient) DeleteWebhook(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deleted = true
+
+	return nil
+}
+
+func TestShutdownWithRequestInFlight(t *testing.T) {
+	const update = `{"update_id": 7, "message": {"message_id": 1, "text": "/rnd",
+		"from": {"id": 1001, "username": "alice"}, "chat": {"id": 42}}}`
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		wantErr    bool
+		wantStatus int
+	}{
+		{"request finishes", 5 * time.Second, false, http.StatusOK},
+		{"request outlasts the timeout", 50 * time.Millisecond, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+
+			tg := &fakeWebhookClient{}
+			f := &Fetcher{tg: tg, cfg: Config{Path: "/webhook", Secret: testSecret, ShutdownTimeout: tt.timeout}}
+
+			started, release := make(chan struct{}), make(chan struct{})
+			defer close(release)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			served := make(chan error, 1)
+			go func() {
+				served <- f.serve(ctx, ln, func([]events.Event) error {
+					close(started)
+					<-release
+					return nil
+				})
+			}()
+
+			status := make(chan int, 1)
+			go func() {
+				req, _ := http.NewRequest(http.MethodPost, "http://"+ln.Addr().String()+"/webhook", strings.NewReader(update))
+				req.Header.Set(SecretHeader, testSecret)
+
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					status <- 0
+					return
+				}
+				_ = resp.Body.Close()
+
+				status <- resp.StatusCode
+			}()
+
+			<-started
+			cancel()
+
+			if !tt.wantErr {
+				select {
+				case err := <-served:
+					t.Fatalf("serve returned %v while a request was being handled", err)
+				case <-time.After(100 * time.Millisecond):
+				}
+
+				release <- struct{}{}
+			}
+
+			if err := <-served; (err != nil) != tt.wantErr {
+				t.Fatalf("serve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := <-status; got != tt.wantStatus {
+				t.Errorf("request status = %d, want %d", got, tt.wantStatus)
+			}
+
+			tg.mu.Lock()
+			defer tg.mu.Unlock()
+
+			if !tg.set || !tg.deleted {
+				t.Errorf("webhook set = %v, deleted = %v, want both", tg.set, tg.deleted)
+			}
+		})
+	}
+}
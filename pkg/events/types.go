@@ -1,32 +1,87 @@
 // Package events defines the core event types and interfaces for the event system.
 package events
 
+import "context"
+
 // Fetcher defines the interface for fetching events from a source.
 type Fetcher interface {
-	Start(handleEventsCallback func(events []Event) error, batchSize int)
+	// Start fetches events and passes them to handleEventsCallback in batches
+	// of up to batchSize events. handleEventsCallback returns once the events
+	// are queued; each event's Done reports when it has been handled.
+	// It blocks until ctx is canceled or fetching fails for good, and returns
+	// nil after a shutdown requested through ctx.
+	Start(ctx context.Context, handleEventsCallback func(events []Event) error, batchSize int) error
 }
 
 // Processor defines the interface for processing events.
 type Processor interface {
 	// Process handles a single event.
-	Process(evt Event) error
+	Process(ctx context.Context, evt Event) error
 }
 
+// Client defines the messaging operations processors use to reply to users.
 type Client interface {
-	SendMessage(chatID int, text string) error
+	// SendMessage sends a text message to the specified chat.
+	SendMessage(ctx context.Context, chatID int, text string) error
+	// SendKeyboard sends a text message with an inline keyboard attached.
+	SendKeyboard(ctx context.Context, chatID int, text string, kb Keyboard) error
+	// EditKeyboard replaces the text and inline keyboard of a previously sent message.
+	EditKeyboard(ctx context.Context, chatID int, messageID int, text string, kb Keyboard) error
+	// AnswerCallbackQuery acknowledges a button press, optionally showing
+	// text to the user as a notification. Every callback query must be answered.
+	AnswerCallbackQuery(ctx context.Context, queryID string, text string) error
+	// SetCommands replaces the command menu Telegram clients show for the bot.
+	SetCommands(ctx context.Context, commands []Command) error
+	// SendDocument uploads a file to the specified chat.
+	SendDocument(ctx context.Context, chatID int, doc Document) error
+	// BotUsername returns the username of the bot, as reported by getMe.
+	BotUsername(ctx context.Context) (string, error)
+}
+
+// Document is a file sent to a chat.
+type Document struct {
+	Name    string // File name shown to the user
+	Data    []byte // File contents
+	Caption string // Text shown under the file, may be empty
+}
+
+// Command is an entry of the bot's command menu.
+type Command struct {
+	Name        string // Command name without the leading slash
+	Description string // Short description shown next to the name
 }
 
+// Button is an inline keyboard button. Pressing it produces
+// a CallbackQuery event carrying Data.
+type Button struct {
+	Text string // Button label
+	Data string // Callback data sent back when the button is pressed
+}
+
+// Keyboard is an inline keyboard made of button rows.
+type Keyboard [][]Button
+
 // Type represents the type of an event.
 type Type int
 
 const (
-	Unknown Type = iota // Unknown event type
-	Message             // Message event type
+	Unknown       Type = iota // Unknown event type
+	Message                   // Message event type
+	CallbackQuery             // Inline keyboard button press
 )
 
+// ChatScoped is implemented by event metadata that belongs to a chat.
+// Consumers use it to keep the events of one chat in order.
+type ChatScoped interface {
+	// ChatKey identifies the chat the event belongs to.
+	ChatKey() int
+}
+
 // Event represents a single event in the system.
+// Done is not encoded with the event, so events decoded from a dead letter have none.
 type Event struct {
 	Type Type   // The type of the event
 	Text string // The text content of the event
 	Meta any    // Additional metadata associated with the event
+	Done func() // Called once the event has been handled, even if it failed; may be nil
 }
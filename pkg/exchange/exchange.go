@@ -0,0 +1,244 @@
+// Package exchange exports saved pages to files other tools can read:
+// Netscape bookmarks HTML, which browsers and bookmarking services import,
+// JSON and CSV.
+package exchange
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/lib/e"
+	"go_link_storage/pkg/storage"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is a file format pages are exported to.
+type Format string
+
+const (
+	FormatHTML Format = "html" // Netscape bookmarks file
+	FormatJSON Format = "json" // JSON array of pages
+	FormatCSV  Format = "csv"  // CSV table with a header row
+)
+
+// Formats lists the supported formats, the default one first.
+var Formats = []Format{FormatHTML, FormatJSON, FormatCSV}
+
+// ErrUnknownFormat is returned for a format that is not one of Formats.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// loadBatch is the number of pages LoadPages requests at once.
+const loadBatch = 500
+
+// ParseFormat returns the format with the given name, ignoring case.
+// An empty name selects the default format.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return Formats[0], nil
+	}
+
+	for _, f := range Formats {
+		if strings.EqualFold(name, string(f)) {
+			return f, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+}
+
+// Ext returns the file name extension of the format, with the leading dot.
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// FileName returns the name of an export file in the format, e.g. "links.html".
+func (f Format) FileName() string {
+	return "links" + f.Ext()
+}
+
+// ContentType returns the MIME type of files in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// LoadPages returns every page of the user, newest first.
+func LoadPages(ctx context.Context, s storage.Storage, userID int64) (pages []*storage.Page, err error) {
+	defer func() { err = e.WrapIfErr("cannot load pages", err) }()
+
+	for {
+		batch, err := s.List(ctx, userID, storage.Filter{}, len(pages), loadBatch)
+		if err != nil {
+			return nil, err
+		}
+
+		pages = append(pages, batch...)
+
+		if len(batch) < loadBatch {
+			return pages, nil
+		}
+	}
+}
+
+// Export writes pages to w in the given format.
+func Export(w io.Writer, f Format, pages []*storage.Page) error {
+	switch f {
+	case FormatHTML:
+		return WriteHTML(w, pages)
+	case FormatJSON:
+		return WriteJSON(w, pages)
+	case FormatCSV:
+		return WriteCSV(w, pages)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+}
+
+// netscapeHeader starts every Netscape bookmarks file.
+const netscapeHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`
+
+// WriteHTML writes pages as a Netscape bookmarks file. Every page is a link
+// titled with the page title, or its URL if it has none, carrying the save
+// and read times and the tags; the note, or the description if there is no
+// note, follows the link.
+func WriteHTML(w io.Writer, pages []*storage.Page) error {
+	var b strings.Builder
+
+	b.WriteString(netscapeHeader)
+
+	for _, p := range pages {
+		fmt.Fprintf(&b, `    <DT><A HREF="%s" ADD_DATE="%d"`, html.EscapeString(p.URL), p.SavedAt.Unix())
+
+		if !p.ReadAt.IsZero() {
+			fmt.Fprintf(&b, ` LAST_VISIT="%d"`, p.ReadAt.Unix())
+		}
+
+		if len(p.Tags) > 0 {
+			fmt.Fprintf(&b, ` TAGS="%s"`, html.EscapeString(strings.Join(p.Tags, ",")))
+		}
+
+		title := p.Title
+		if title == "" {
+			title = p.URL
+		}
+
+		fmt.Fprintf(&b, ">%s</A>\n", html.EscapeString(title))
+
+		note := p.Note
+		if note == "" {
+			note = p.Description
+		}
+
+		if note != "" {
+			fmt.Fprintf(&b, "    <DD>%s\n", html.EscapeString(note))
+		}
+	}
+
+	b.WriteString("</DL><p>\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// record is the JSON form of a page.
+type record struct {
+	URL         string     `json:"url"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	SiteName    string     `json:"site_name,omitempty"`
+	ImageURL    string     `json:"image_url,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Note        string     `json:"note,omitempty"`
+	SavedAt     time.Time  `json:"saved_at"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	SourceName  string     `json:"source_name,omitempty"`
+	SourceURL   string     `json:"source_url,omitempty"`
+}
+
+// WriteJSON writes pages as an indented JSON array. Empty fields are left out.
+func WriteJSON(w io.Writer, pages []*storage.Page) error {
+	records := make([]record, 0, len(pages))
+
+	for _, p := range pages {
+		r := record{
+			URL:         p.URL,
+			Title:       p.Title,
+			Description: p.Description,
+			SiteName:    p.SiteName,
+			ImageURL:    p.ImageURL,
+			Tags:        p.Tags,
+			Note:        p.Note,
+			SavedAt:     p.SavedAt,
+			SourceName:  p.SourceName,
+			SourceURL:   p.SourceURL,
+		}
+
+		if !p.ReadAt.IsZero() {
+			r.ReadAt = &p.ReadAt
+		}
+
+		records = append(records, r)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(records)
+}
+
+// csvHeader names the columns written by WriteCSV.
+var csvHeader = []string{
+	"url", "title", "description", "site_name", "image_url", "tags", "note",
+	"saved_at", "read_at", "source_name", "source_url",
+}
+
+// WriteCSV writes pages as CSV with a header row. Tags are separated by
+// spaces and times are in RFC 3339; the read time is empty for unread pages.
+func WriteCSV(w io.Writer, pages []*storage.Page) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, p := range pages {
+		readAt := ""
+		if !p.ReadAt.IsZero() {
+			readAt = p.ReadAt.UTC().Format(time.RFC3339)
+		}
+
+		err := cw.Write([]string{
+			p.URL, p.Title, p.Description, p.SiteName, p.ImageURL, strings.Join(p.Tags, " "), p.Note,
+			p.SavedAt.UTC().Format(time.RFC3339), readAt, p.SourceName, p.SourceURL,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
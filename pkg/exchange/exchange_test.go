@@ -0,0 +1,159 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPages returns a fully filled read page and a bare unread one.
+func testPages() []*storage.Page {
+	return []*storage.Page{
+		{
+			URL:         "https://example.com/a?x=1&y=2",
+			Title:       `Tips & "tricks"`,
+			Description: "About <Go>",
+			SiteName:    "Example",
+			ImageURL:    "https://example.com/a.png",
+			Tags:        []string{"go", "perf"},
+			Note:        "Read twice",
+			SavedAt:     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			ReadAt:      time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+			SourceName:  "Go News",
+			SourceURL:   "https://t.me/gonews/1",
+		},
+		{
+			URL:     "https://example.com/b",
+			SavedAt: time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := WriteHTML(&b, testPages()); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+
+	want := netscapeHeader +
+		`    <DT><A HREF="https://example.com/a?x=1&amp;y=2" ADD_DATE="1714557600" LAST_VISIT="1714644000" TAGS="go,perf">Tips &amp; &#34;tricks&#34;</A>` + "\n" +
+		"    <DD>Read twice\n" +
+		`    <DT><A HREF="https://example.com/b" ADD_DATE="1711965600">https://example.com/b</A>` + "\n" +
+		"</DL><p>\n"
+
+	if got := b.String(); got != want {
+		t.Errorf("WriteHTML wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := WriteJSON(&b, testPages()); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+
+	var got []map[string]any
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("WriteJSON wrote %d records, want 2", len(got))
+	}
+
+	if got[0]["read_at"] != "2024-05-02T10:00:00Z" || got[0]["title"] != `Tips & "tricks"` || got[0]["source_url"] != "https://t.me/gonews/1" {
+		t.Errorf("first record = %v", got[0])
+	}
+
+	want := map[string]any{"url": "https://example.com/b", "saved_at": "2024-04-01T10:00:00Z"}
+	if fmt.Sprint(got[1]) != fmt.Sprint(want) {
+		t.Errorf("second record = %v, want %v", got[1], want)
+	}
+
+	b.Reset()
+
+	if err := WriteJSON(&b, nil); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+
+	if got := strings.TrimSpace(b.String()); got != "[]" {
+		t.Errorf("WriteJSON without pages = %q, want []", got)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := WriteCSV(&b, testPages()); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	want := [][]string{
+		csvHeader,
+		{
+			"https://example.com/a?x=1&y=2", `Tips & "tricks"`, "About <Go>", "Example", "https://example.com/a.png",
+			"go perf", "Read twice", "2024-05-01T10:00:00Z", "2024-05-02T10:00:00Z", "Go News", "https://t.me/gonews/1",
+		},
+		{"https://example.com/b", "", "", "", "", "", "", "2024-04-01T10:00:00Z", "", "", ""},
+	}
+
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("WriteCSV rows = %q, want %q", rows, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Format
+		wantErr error
+	}{
+		{name: "", want: FormatHTML},
+		{name: "JSON", want: FormatJSON},
+		{name: "csv", want: FormatCSV},
+		{name: "xml", wantErr: ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.name)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadPages(t *testing.T) {
+	ctx := context.Background()
+	s := files.New(t.TempDir())
+	n := loadBatch + 1
+
+	for i := range n {
+		if err := s.Save(ctx, &storage.Page{URL: fmt.Sprintf("https://example.com/%d", i), UserID: 1}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	pages, err := LoadPages(ctx, s, 1)
+	if err != nil {
+		t.Fatalf("LoadPages: %v", err)
+	}
+
+	if len(pages) != n {
+		t.Errorf("LoadPages returned %d pages, want %d", len(pages), n)
+	}
+}
@@ -0,0 +1,131 @@
+package preview
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxTitleLen       = 200 // Runes of the title kept
+	maxDescriptionLen = 500 // Runes of the description kept
+	maxSiteNameLen    = 100 // Runes of the site name kept
+)
+
+// Parse extracts the preview from an HTML document read from r.
+// OpenGraph tags win over Twitter card tags, which win over <title> and
+// the description meta tag. Relative image URLs are resolved against base.
+// Parsing stops at the end of <head>, and a document cut short by a size
+// limit yields what was found before the cut.
+func Parse(r io.Reader, base *url.URL) (Preview, error) {
+	var (
+		meta  = make(map[string]string) // First content of every meta property or name
+		title strings.Builder
+	)
+
+	z := html.NewTokenizer(r)
+
+	for inTitle := false; ; {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return Preview{}, err
+			}
+
+			return newPreview(meta, title.String(), base), nil
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = tt == html.StartTagToken
+			case atom.Meta:
+				if hasAttr {
+					addMeta(z, meta)
+				}
+			case atom.Body:
+				return newPreview(meta, title.String(), base), nil
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return newPreview(meta, title.String(), base), nil
+			}
+		}
+	}
+}
+
+// addMeta records the content of a <meta> tag under its property or name,
+// lowercased. Only the first tag with a given key counts.
+func addMeta(z *html.Tokenizer, meta map[string]string) {
+	var key, content string
+
+	for more := true; more; {
+		var k, v []byte
+
+		k, v, more = z.TagAttr()
+
+		switch string(k) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(v)))
+			}
+		case "content":
+			content = string(v)
+		}
+	}
+
+	if _, ok := meta[key]; key != "" && !ok {
+		meta[key] = content
+	}
+}
+
+// newPreview picks the preview fields from the collected tags.
+func newPreview(meta map[string]string, title string, base *url.URL) Preview {
+	return Preview{
+		Title:       clean(first(meta["og:title"], meta["twitter:title"], title), maxTitleLen),
+		Description: clean(first(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLen),
+		SiteName:    clean(meta["og:site_name"], maxSiteNameLen),
+		ImageURL: resolve(base, strings.TrimSpace(first(
+			meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"],
+			meta["twitter:image"], meta["twitter:image:src"],
+		))),
+	}
+}
+
+// first returns the first value that is not blank.
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// clean collapses whitespace in s and cuts it to at most maxLen runes,
+// marking the cut with an ellipsis.
+func clean(s string, maxLen int) string {
+	s = strings.Join(strings.Fields(s), " ")
+
+	if r := []rune(s); len(r) > maxLen {
+		return strings.TrimSpace(string(r[:maxLen-1])) + "…"
+	}
+
+	return s
+}
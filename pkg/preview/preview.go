@@ -0,0 +1,178 @@
+// Package preview fetches saved web pages and extracts what a link preview shows:
+// the title, description, site name and image, taken from <title>, OpenGraph
+// and Twitter card tags.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/lib/e"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	defaultTimeout  = 10 * time.Second // Time limit of a fetch, including redirects and the body
+	defaultMaxBytes = 1 << 20          // Bytes of the page read; the head is almost always within them
+	maxRedirects    = 5                // Redirects followed before giving up
+
+	userAgent = "Mozilla/5.0 (compatible; go_link_storage preview)" // Some sites serve nothing to unknown agents
+)
+
+var (
+	// ErrNotHTML is returned when the page is not an HTML document.
+	ErrNotHTML = errors.New("not an HTML page")
+	// ErrForbiddenAddress is returned when the page resolves to a private or local address.
+	ErrForbiddenAddress = errors.New("forbidden address")
+)
+
+// Preview is the metadata of a web page shown in link previews.
+type Preview struct {
+	Title       string // Page title
+	Description string // Short description of the page content
+	SiteName    string // Name of the site the page belongs to
+	ImageURL    string // Absolute URL of the preview image
+}
+
+// Fetcher downloads pages within time and size limits and extracts their previews.
+type Fetcher struct {
+	client   http.Client // HTTP client with the time limit and redirect policy
+	maxBytes int64       // Bytes of the page read at most
+}
+
+// New creates a Fetcher that gives up after timeout and reads at most maxBytes of a page.
+// Zero values select the defaults. Pages on private and local addresses are never
+// fetched, since the URLs come from users.
+func New(timeout time.Duration, maxBytes int64) *Fetcher {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connections checkAddress looks at meaningless.
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout: timeout,
+		Control: checkAddress,
+	}).DialContext
+
+	return &Fetcher{
+		client: http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+
+				return nil
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// Fetch downloads the page at rawURL and returns its preview.
+// The page is decoded to UTF-8 using the charset from the Content-Type header,
+// a byte order mark or a <meta> tag.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (p Preview, err error) {
+	defer func() { err = e.WrapIfErr("cannot fetch preview", err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Preview{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isHTML(contentType) {
+		return Preview{}, ErrNotHTML
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.maxBytes), contentType)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	return Parse(body, resp.Request.URL)
+}
+
+// isHTML reports whether the Content-Type describes an HTML document.
+// A missing Content-Type is given the benefit of the doubt.
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// checkAddress refuses connections to addresses that are not public,
+// so users cannot make the bot probe the network it runs in.
+// It runs after name resolution, for every address tried.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+// resolve returns ref as an absolute URL relative to base, or an empty
+// string if ref is empty or not a valid http(s) URL.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+
+	return u.String()
+}
@@ -0,0 +1,205 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/files"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+
+	tests := []struct {
+		name string
+		doc  string
+		want Preview
+	}{
+		{
+			name: "open graph wins",
+			doc: `<html><head><title>Plain title</title>
+				<meta property="og:title" content="OG title">
+				<meta name="twitter:title" content="Twitter title">
+				<meta name="description" content="Plain description">
+				<meta property="og:description" content="OG description">
+				<meta property="og:site_name" content="Example">
+				<meta property="og:image" content="/img/cover.png">
+				</head><body></body></html>`,
+			want: Preview{
+				Title:       "OG title",
+				Description: "OG description",
+				SiteName:    "Example",
+				ImageURL:    "https://example.com/img/cover.png",
+			},
+		},
+		{
+			name: "twitter card and title fallbacks",
+			doc: `<head><title>  Tom &amp;
+				Jerry </title>
+				<meta name="Twitter:Description" content="From the card">
+				<meta name="twitter:image" content="https://cdn.example.com/a.jpg">`,
+			want: Preview{
+				Title:       "Tom & Jerry",
+				Description: "From the card",
+				ImageURL:    "https://cdn.example.com/a.jpg",
+			},
+		},
+		{
+			name: "body is not searched",
+			doc:  `<head><title>Head</title></head><body><meta property="og:title" content="Body"></body>`,
+			want: Preview{Title: "Head"},
+		},
+		{
+			name: "document cut short",
+			doc:  `<head><title>Cut`,
+			want: Preview{Title: "Cut"},
+		},
+		{
+			name: "unsupported image scheme",
+			doc:  `<meta property="og:image" content="javascript:alert(1)">`,
+			want: Preview{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.doc), base)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cp1251", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=windows-1251")
+		_, _ = w.Write([]byte("<title>\xcf\xf0\xe8\xe2\xe5\xf2</title>"))
+	})
+	mux.HandleFunc("/meta-charset", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<meta charset="windows-1251"><title>` + "\xcf\xf0\xe8\xe2\xe5\xf2</title>"))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<head><!--" + strings.Repeat("x", 4096) + "--><title>Too far</title>"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<meta property="og:image" content="cover.png">`))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// The test server listens on a loopback address, which New refuses to reach.
+	f := New(time.Second, 1024)
+	f.client.Transport = srv.Client().Transport
+
+	tests := []struct {
+		path    string
+		want    Preview
+		wantErr error
+	}{
+		{path: "/cp1251", want: Preview{Title: "Привет"}},
+		{path: "/meta-charset", want: Preview{Title: "Привет"}},
+		{path: "/image", wantErr: ErrNotHTML},
+		{path: "/large", want: Preview{}},
+		{path: "/redirect", want: Preview{ImageURL: srv.URL + "/cover.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := f.Fetch(context.Background(), srv.URL+tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Fetch error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("Fetch = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchForbiddenAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the local server")
+	}))
+	defer srv.Close()
+
+	_, err := New(time.Second, 0).Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Fetch error = %v, want %v", err, ErrForbiddenAddress)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<title>Saved page</title><meta name="description" content="About it">`))
+	}))
+	defer srv.Close()
+
+	f := New(time.Second, 0)
+	f.client.Transport = srv.Client().Transport
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := files.New(t.TempDir())
+
+	p := &storage.Page{URL: srv.URL, UserID: 1}
+	if err := store.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	q := NewQueue(f, store, 1, 1)
+
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	q.Enqueue(p)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		got, err := store.PickRandom(ctx, 1, storage.Filter{})
+		if err != nil {
+			t.Fatalf("PickRandom: %v", err)
+		}
+
+		if got.Title == "Saved page" && got.Description == "About it" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("preview was not saved: %+v", got)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,83 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"go_link_storage/pkg/storage"
+	"log"
+	"sync"
+)
+
+// Queue fetches previews of saved pages in the background and stores them.
+type Queue struct {
+	fetcher *Fetcher           // Fetcher of page previews
+	store   storage.Storage    // Storage the previews are saved to
+	jobs    chan *storage.Page // Pages waiting for their previews
+	workers int                // Number of concurrent fetches
+}
+
+// NewQueue creates a queue that fetches previews with fetcher using the given
+// number of workers and saves them to store. Up to size pages wait for a worker.
+func NewQueue(fetcher *Fetcher, store storage.Storage, workers, size int) *Queue {
+	return &Queue{
+		fetcher: fetcher,
+		store:   store,
+		jobs:    make(chan *storage.Page, size),
+		workers: max(workers, 1),
+	}
+}
+
+// Enqueue schedules fetching the preview of p, which must have been saved.
+// It never blocks: when the queue is full the page is left without a preview.
+func (q *Queue) Enqueue(p *storage.Page) {
+	job := &storage.Page{ID: p.ID, UserID: p.UserID, URL: p.URL}
+
+	select {
+	case q.jobs <- job:
+	default:
+		log.Printf("[WARN] preview: queue is full, skipping %s", p.URL)
+	}
+}
+
+// Run fetches previews of enqueued pages until ctx is canceled.
+// Pages still waiting when it returns are left without previews.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range q.workers {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case p := <-q.jobs:
+					if err := q.update(ctx, p); err != nil && ctx.Err() == nil {
+						log.Printf("[WARN] preview: %s: %s", p.URL, err)
+					}
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+}
+
+// update fetches the preview of p and saves it. Pages removed in the meantime
+// are skipped.
+func (q *Queue) update(ctx context.Context, p *storage.Page) error {
+	preview, err := q.fetcher.Fetch(ctx, p.URL)
+	if err != nil {
+		return err
+	}
+
+	p.Title = preview.Title
+	p.Description = preview.Description
+	p.SiteName = preview.SiteName
+	p.ImageURL = preview.ImageURL
+
+	if err := q.store.SetPreview(ctx, p); err != nil && !errors.Is(err, storage.ErrPageNotFound) {
+		return err
+	}
+
+	return nil
+}
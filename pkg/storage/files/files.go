@@ -1,38 +1,89 @@
 // Package files provides a file-based implementation of the storage.Storage interface.
-// Pages are stored as individual files using gob encoding, organized by username.
+// Pages are stored as individual files using gob encoding, organized by user ID.
 package files
 
 import (
+	"context"
+	crand "crypto/rand"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"go_link_storage/pkg/lib/e"
 	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/urlnorm"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Storage implements the storage.Storage interface using the file system.
 type Storage struct {
-	basePath string // Base directory path for storing files
+	basePath string       // Base directory path for storing files
+	index    *searchIndex // Search index shared by the copies of the storage
+	locks    *userLocks   // Write locks shared by the copies of the storage
 }
 
-const defaultPerm = 0774 // Default file permissions for created directories
+// userLocks serializes the writes to the pages of each user. Updates read,
+// change and write back a whole file, so without the lock concurrent updates
+// of a page, such as a preview and a read mark, would overwrite each other.
+type userLocks struct {
+	mu    sync.Mutex            // Guards users
+	users map[int64]*sync.Mutex // Locks by user ID
+}
+
+// lock locks the pages of the user and returns the function unlocking them.
+func (l *userLocks) lock(userID int64) (unlock func()) {
+	l.mu.Lock()
+	m, ok := l.users[userID]
+	if !ok {
+		m = &sync.Mutex{}
+		l.users[userID] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+
+	return m.Unlock
+}
+
+const (
+	defaultPerm = 0774   // Default file permissions for created directories
+	tmpSuffix   = ".tmp" // Marks files that are still being written
+
+	// offsetsDir and deadLettersDir hold stream offsets and dead letters.
+	// User directories are named after numeric IDs, or usernames for pages
+	// of older versions, neither of which can start with a dot.
+	offsetsDir     = ".offsets"
+	deadLettersDir = ".dead_letters"
+
+	// canonicalMarker is created in the base directory once the pages saved
+	// before URL canonicalization have been brought to canonical URLs.
+	canonicalMarker = ".canonical_urls"
+)
 
 // New creates a new file-based storage instance with the given base path.
 func New(basePath string) Storage {
-	return Storage{basePath: basePath}
+	return Storage{
+		basePath: basePath,
+		index:    newSearchIndex(),
+		locks:    &userLocks{users: make(map[int64]*sync.Mutex)},
+	}
 }
 
 // Save stores a page as a file in the file system.
-// The file is encoded using gob and stored in a directory named after the username.
-func (s Storage) Save(page *storage.Page) (err error) {
+// The file is encoded using gob and stored in a directory named after the user ID.
+// Saving a page that already exists for the user is a no-op.
+// On insert the canonical URL, the normalized tags, the ID and SavedAt are written back to p.
+func (s Storage) Save(ctx context.Context, page *storage.Page) (err error) {
 	defer func() { err = e.WrapIfErr("cannot save page", err) }()
 
-	fPath := filepath.Join(s.basePath, page.UserName)
-
-	if err := os.MkdirAll(fPath, defaultPerm); err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
@@ -41,68 +92,246 @@ func (s Storage) Save(page *storage.Page) (err error) {
 		return err
 	}
 
-	fPath = filepath.Join(fPath, fName)
+	saved := *page
+	saved.URL = urlnorm.Normalize(page.URL)
+	saved.Tags = storage.NormalizeTags(page.Tags)
+	saved.ID = fName
+	if saved.SavedAt.IsZero() {
+		saved.SavedAt = time.Now().UTC()
+	}
 
-	file, err := os.Create(fPath)
+	defer s.locks.lock(page.UserID)()
+
+	// Link fails if the target exists, so an existing page is never replaced.
+	err = s.writeFile(ctx, &saved, os.Link)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	defer func() { _ = file.Close() }()
 
-	if err := gob.NewEncoder(file).Encode(page); err != nil {
+	s.index.invalidate(page.UserID)
+
+	page.URL = saved.URL
+	page.Tags = saved.Tags
+	page.ID = saved.ID
+	page.SavedAt = saved.SavedAt
+
+	return nil
+}
+
+// writeFile encodes the page into a temporary file in the user's directory
+// and then moves it into place with publish, so concurrent readers never
+// observe a partially written page.
+func (s Storage) writeFile(ctx context.Context, page *storage.Page, publish func(oldPath, newPath string) error) error {
+	return writeGob(ctx, s.userPath(page.UserID), page.ID, page, publish)
+}
+
+// writeGob encodes v into a temporary file in dir and then moves it
+// to dir/name with publish.
+func writeGob(ctx context.Context, dir string, name string, v any, publish func(oldPath, newPath string) error) error {
+	if err := os.MkdirAll(dir, defaultPerm); err != nil {
 		return err
 	}
 
-	return nil
+	file, err := os.CreateTemp(dir, name+"-*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := file.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	if err := gob.NewEncoder(file).Encode(v); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return publish(tmpPath, filepath.Join(dir, name))
 }
 
-// PickRandom selects and returns a random page from the files stored for the given user.
-func (s Storage) PickRandom(userName string) (page *storage.Page, err error) {
+// PickRandom selects and returns a random page matching f from the files stored for the given user.
+// It returns storage.ErrNoSavedPages if the user has no such pages.
+func (s Storage) PickRandom(ctx context.Context, userID int64, f storage.Filter) (page *storage.Page, err error) {
 	defer func() { err = e.WrapIfErr("cannot pick page", err) }()
 
-	path := filepath.Join(s.basePath, userName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	files, err := os.ReadDir(path)
+	pages, err := s.userPages(ctx, userID, f)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(files) == 0 {
+	if len(pages) == 0 {
 		return nil, storage.ErrNoSavedPages
 	}
 
-	n := rand.Intn(len(files))
-
-	file := files[n]
-
-	return s.decodePage(filepath.Join(path, file.Name()))
+	return pages[rand.Intn(len(pages))], nil
 }
 
 // Remove deletes the file associated with the given page.
-func (s Storage) Remove(p *storage.Page) error {
+func (s Storage) Remove(ctx context.Context, p *storage.Page) error {
+	if err := ctx.Err(); err != nil {
+		return e.Wrap("cannot remove page", err)
+	}
+
 	fileName, err := fileName(p)
 	if err != nil {
 		return e.Wrap("cannot remove page", err)
 	}
 
-	path := filepath.Join(s.basePath, p.UserName, fileName)
+	path := filepath.Join(s.userPath(p.UserID), fileName)
 
-	if err := os.Remove(path); err != nil {
+	// An update running at the same time would write the page back.
+	defer s.locks.lock(p.UserID)()
+
+	// Removing a page that is not saved is a no-op, as in the SQL backends.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
 		msg := fmt.Sprintf("cannot remove file %s", path)
 		return e.Wrap(msg, err)
 	}
 
+	s.index.invalidate(p.UserID)
+
+	return nil
+}
+
+// SetReadAt updates the read time of the page identified by p.ID and p.UserID.
+func (s Storage) SetReadAt(ctx context.Context, p *storage.Page, readAt time.Time) error {
+	err := s.updatePage(ctx, p, func(saved *storage.Page) {
+		saved.ReadAt = readAt
+	})
+	if err != nil {
+		return err
+	}
+
+	p.ReadAt = readAt
+
+	return nil
+}
+
+// SetPreview updates the preview fields of the page identified by p.ID and p.UserID.
+func (s Storage) SetPreview(ctx context.Context, p *storage.Page) error {
+	return s.updatePage(ctx, p, func(saved *storage.Page) {
+		saved.Title = p.Title
+		saved.Description = p.Description
+		saved.SiteName = p.SiteName
+		saved.ImageURL = p.ImageURL
+	})
+}
+
+// AddTags adds tags to the page identified by p.ID and p.UserID
+// and writes the resulting tags back to p.
+func (s Storage) AddTags(ctx context.Context, p *storage.Page, tags []string) error {
+	var merged []string
+
+	err := s.updatePage(ctx, p, func(saved *storage.Page) {
+		saved.Tags = storage.NormalizeTags(append(slices.Clone(saved.Tags), tags...))
+		merged = saved.Tags
+	})
+	if err != nil {
+		return err
+	}
+
+	p.Tags = merged
+
+	return nil
+}
+
+// Tags returns the tags of the user's pages with the number of pages carrying each,
+// most used first. Every file of the user is decoded, like in List.
+func (s Storage) Tags(ctx context.Context, userID int64) (res []storage.TagCount, err error) {
+	defer func() { err = e.WrapIfErr("cannot count tags", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	pages, err := s.userPages(ctx, userID, storage.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, p := range pages {
+		for _, tag := range p.Tags {
+			counts[tag]++
+		}
+	}
+
+	for name, n := range counts {
+		res = append(res, storage.TagCount{Name: name, Pages: n})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Pages != res[j].Pages {
+			return res[i].Pages > res[j].Pages
+		}
+
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// updatePage applies update to the stored page identified by p.ID and p.UserID
+// and writes it back, holding the user's write lock throughout.
+func (s Storage) updatePage(ctx context.Context, p *storage.Page, update func(saved *storage.Page)) (err error) {
+	defer func() { err = e.WrapIfErr("cannot update page", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// IDs come from callback data, so anything that is not a plain file name is rejected.
+	if !isFileName(p.ID) {
+		return storage.ErrPageNotFound
+	}
+
+	defer s.locks.lock(p.UserID)()
+
+	saved, err := s.decodePage(filepath.Join(s.userPath(p.UserID), p.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		return storage.ErrPageNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	update(saved)
+
+	if err := s.writeFile(ctx, saved, os.Rename); err != nil {
+		return err
+	}
+
+	s.index.invalidate(p.UserID)
+
 	return nil
 }
 
 // Exists checks if a file exists for the given page.
-func (s Storage) Exists(p *storage.Page) (bool, error) {
+func (s Storage) Exists(ctx context.Context, p *storage.Page) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, e.Wrap("cannot check if file exists", err)
+	}
+
 	fileName, err := fileName(p)
 	if err != nil {
 		return false, e.Wrap("cannot check if file exists", err)
 	}
 
-	path := filepath.Join(s.basePath, p.UserName, fileName)
+	path := filepath.Join(s.userPath(p.UserID), fileName)
 
 	switch _, err = os.Stat(path); {
 	case errors.Is(err, os.ErrNotExist):
@@ -115,7 +344,473 @@ func (s Storage) Exists(p *storage.Page) (bool, error) {
 	return true, nil
 }
 
+// List returns a page of the user's saved pages matching f, newest first.
+// Every file of the user is decoded, so it is only suitable for small collections.
+func (s Storage) List(ctx context.Context, userID int64, f storage.Filter, offset, limit int) (pages []*storage.Page, err error) {
+	defer func() { err = e.WrapIfErr("cannot list pages", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	pages, err = s.userPages(ctx, userID, f)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(pages, func(i, j int) bool {
+		if !pages[i].SavedAt.Equal(pages[j].SavedAt) {
+			return pages[i].SavedAt.After(pages[j].SavedAt)
+		}
+
+		return pages[i].ID > pages[j].ID
+	})
+
+	if offset >= len(pages) {
+		return nil, nil
+	}
+
+	return pages[offset:min(offset+limit, len(pages))], nil
+}
+
+// MigrateUser moves the pages older versions saved in the userName directory
+// to the directory of userID and removes the legacy directory once it is empty.
+// Pages the user has already saved under userID are kept.
+func (s Storage) MigrateUser(ctx context.Context, userName string, userID int64) (err error) {
+	defer func() { err = e.WrapIfErr("cannot migrate user", err) }()
+
+	// Legacy directories are named after usernames, which never start with a dot
+	// or look like a number, so nothing else is touched by mistake.
+	if !isFileName(userName) || strings.HasPrefix(userName, ".") {
+		return nil
+	}
+
+	dir := filepath.Join(s.basePath, userName)
+
+	names, err := pageFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, name)
+
+		p, err := s.decodePage(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Moved concurrently.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		p.ID = ""
+		p.UserID = userID
+		p.UserName = userName
+
+		if err := s.Save(ctx, p); err != nil {
+			return err
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// Removing fails if a file is still being written to the directory;
+	// it is left for the next call then.
+	_ = os.Remove(dir)
+
+	return nil
+}
+
+// Init brings the pages saved by older versions up to date: their URLs are
+// canonicalized and their files renamed after the hash of the canonical URL.
+// It does the work once per base directory, recorded by a marker file.
+func (s Storage) Init(ctx context.Context) (err error) {
+	defer func() { err = e.WrapIfErr("cannot init storage", err) }()
+
+	marker := filepath.Join(s.basePath, canonicalMarker)
+
+	switch _, err := os.Stat(marker); {
+	case err == nil:
+		return nil
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	entries, err := os.ReadDir(s.basePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, entry := range entries {
+		// Only directories of user IDs are upgraded; MigrateUser saves
+		// the pages of legacy username directories anew.
+		userID, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+
+		if err := s.canonicalizeUser(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(s.basePath, defaultPerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(marker, nil, 0664)
+}
+
+// canonicalizeUser rewrites the pages of the user whose URLs are not canonical
+// and moves them to files named after the canonical hash. A page whose
+// canonical file already exists is merged into it: the file keeps its page
+// and gets the tags of the merged one.
+func (s Storage) canonicalizeUser(ctx context.Context, userID int64) error {
+	dir := s.userPath(userID)
+
+	names, err := pageFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, name)
+
+		p, err := s.decodePage(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed concurrently.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		p.URL = urlnorm.Normalize(p.URL)
+		p.UserID = userID
+
+		canonical, err := fileName(p)
+		if err != nil {
+			return err
+		}
+
+		if canonical == name && p.ID == name {
+			continue
+		}
+
+		p.ID = canonical
+
+		kept, err := s.decodePage(filepath.Join(dir, canonical))
+		switch {
+		case canonical != name && err == nil:
+			kept.ID = canonical
+			kept.Tags = storage.NormalizeTags(append(kept.Tags, p.Tags...))
+			p = kept
+		case canonical != name && !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+
+		if err := s.writeFile(ctx, p, os.Rename); err != nil {
+			return err
+		}
+
+		if canonical != name {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	s.index.invalidate(userID)
+
+	return nil
+}
+
+// Offset returns the stored offset of the named stream, or 0 if none is stored.
+func (s Storage) Offset(ctx context.Context, name string) (offset int, err error) {
+	defer func() { err = e.WrapIfErr("cannot read offset", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	path, err := s.offsetPath(name)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// SetOffset stores the offset of the named stream, replacing the previous one.
+// The file is replaced atomically, so a crash never leaves a partial offset.
+func (s Storage) SetOffset(ctx context.Context, name string, offset int) (err error) {
+	defer func() { err = e.WrapIfErr("cannot save offset", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := s.offsetPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), defaultPerm); err != nil {
+		return err
+	}
+
+	tmp := path + tmpSuffix
+
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(offset)), 0664); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// offsetPath returns the file holding the offset of the named stream.
+func (s Storage) offsetPath(name string) (string, error) {
+	if !isFileName(name) {
+		return "", fmt.Errorf("invalid offset name %q", name)
+	}
+
+	return filepath.Join(s.basePath, offsetsDir, name), nil
+}
+
+// AddDeadLetter stores a new dead letter and writes the assigned ID back to d.
+func (s Storage) AddDeadLetter(ctx context.Context, d *storage.DeadLetter) (err error) {
+	defer func() { err = e.WrapIfErr("cannot save dead letter", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	saved := *d
+	saved.ID = crand.Text()
+
+	if err := writeGob(ctx, s.deadLettersPath(), saved.ID, &saved, os.Link); err != nil {
+		return err
+	}
+
+	d.ID = saved.ID
+
+	return nil
+}
+
+// UpdateDeadLetter saves Error, Attempts and NextAttemptAt of the dead letter identified by d.ID.
+func (s Storage) UpdateDeadLetter(ctx context.Context, d *storage.DeadLetter) (err error) {
+	defer func() { err = e.WrapIfErr("cannot update dead letter", err) }()
+
+	saved, err := s.DeadLetter(ctx, d.ID)
+	if err != nil {
+		return err
+	}
+
+	saved.Error = d.Error
+	saved.Attempts = d.Attempts
+	saved.NextAttemptAt = d.NextAttemptAt
+
+	return writeGob(ctx, s.deadLettersPath(), saved.ID, saved, os.Rename)
+}
+
+// RemoveDeadLetter deletes the dead letter with the given ID.
+func (s Storage) RemoveDeadLetter(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return e.Wrap("cannot remove dead letter", err)
+	}
+
+	if !isFileName(id) {
+		return storage.ErrDeadLetterNotFound
+	}
+
+	err := os.Remove(filepath.Join(s.deadLettersPath(), id))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return storage.ErrDeadLetterNotFound
+	case err != nil:
+		return e.Wrap("cannot remove dead letter", err)
+	}
+
+	return nil
+}
+
+// DeadLetter returns the dead letter with the given ID.
+func (s Storage) DeadLetter(ctx context.Context, id string) (*storage.DeadLetter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, e.Wrap("cannot read dead letter", err)
+	}
+
+	if !isFileName(id) {
+		return nil, storage.ErrDeadLetterNotFound
+	}
+
+	d, err := decodeDeadLetter(filepath.Join(s.deadLettersPath(), id))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, storage.ErrDeadLetterNotFound
+	case err != nil:
+		return nil, e.Wrap("cannot read dead letter", err)
+	}
+
+	return d, nil
+}
+
+// DeadLetters returns up to limit dead letters, all of them or only those due by due.
+// Every dead letter is decoded, which is fine as long as failures stay rare.
+func (s Storage) DeadLetters(ctx context.Context, due time.Time, limit int) (res []*storage.DeadLetter, err error) {
+	defer func() { err = e.WrapIfErr("cannot list dead letters", err) }()
+
+	dir := s.deadLettersPath()
+
+	names, err := pageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		d, err := decodeDeadLetter(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed concurrently.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if due.IsZero() || (!d.NextAttemptAt.IsZero() && !d.NextAttemptAt.After(due)) {
+			res = append(res, d)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i].FailedAt, res[j].FailedAt
+		if !due.IsZero() {
+			a, b = res[i].NextAttemptAt, res[j].NextAttemptAt
+		}
+
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+
+		return res[i].ID < res[j].ID
+	})
+
+	return res[:min(limit, len(res))], nil
+}
+
+// deadLettersPath returns the directory holding dead letters.
+func (s Storage) deadLettersPath() string {
+	return filepath.Join(s.basePath, deadLettersDir)
+}
+
+// decodeDeadLetter reads and decodes a dead letter from a file using gob.
+func decodeDeadLetter(filePath string) (*storage.DeadLetter, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var d storage.DeadLetter
+
+	if err := gob.NewDecoder(f).Decode(&d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// userPages decodes every page saved by the given user that matches f.
+func (s Storage) userPages(ctx context.Context, userID int64, f storage.Filter) ([]*storage.Page, error) {
+	path := s.userPath(userID)
+
+	names, err := pageFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*storage.Page, 0, len(names))
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		p, err := s.decodePage(filepath.Join(path, name))
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed concurrently.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Match(p) {
+			res = append(res, p)
+		}
+	}
+
+	return res, nil
+}
+
+// userPath returns the directory holding the pages of the given user.
+func (s Storage) userPath(userID int64) string {
+	return filepath.Join(s.basePath, strconv.FormatInt(userID, 10))
+}
+
+// pageFiles returns the names of the page files in dir, skipping files
+// that are still being written. A missing directory has no pages.
+func pageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(entries))
+
+	for _, f := range entries {
+		if !f.IsDir() && !strings.HasSuffix(f.Name(), tmpSuffix) {
+			res = append(res, f.Name())
+		}
+	}
+
+	return res, nil
+}
+
 // decodePage reads and decodes a page from a file using gob.
+// Pages written by older versions lack ID and SavedAt; they are
+// filled from the file name and modification time.
 func (s Storage) decodePage(filePath string) (*storage.Page, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -129,9 +824,28 @@ func (s Storage) decodePage(filePath string) (*storage.Page, error) {
 		return nil, e.Wrap("cannot decode page", err)
 	}
 
+	if p.ID == "" {
+		p.ID = filepath.Base(filePath)
+	}
+
+	if p.SavedAt.IsZero() {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, e.Wrap("cannot decode page", err)
+		}
+
+		p.SavedAt = info.ModTime().UTC()
+	}
+
 	return &p, nil
 }
 
+// isFileName reports whether name is a plain name of a published file.
+// Names taken from user input are checked with it before touching the file system.
+func isFileName(name string) bool {
+	return name != "" && filepath.Base(name) == name && !strings.HasSuffix(name, tmpSuffix)
+}
+
 // fileName generates a filename for a page based on its hash.
 func fileName(p *storage.Page) (string, error) {
 	return p.Hash()
@@ -0,0 +1,100 @@
+package files
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/storagetest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New(t.TempDir())
+	})
+}
+
+func TestLegacyURLs(t *testing.T) {
+	storagetest.RunLegacyURLs(t, func(t *testing.T) storage.Storage {
+		return New(t.TempDir())
+	}, func(t *testing.T, st storage.Storage, pages ...*storage.Page) {
+		ctx := context.Background()
+		s := st.(Storage)
+
+		// Files were named after the hash of the raw URL before canonicalization.
+		for _, p := range pages {
+			p.ID = fmt.Sprintf("%x", sha1.Sum([]byte(p.URL+strconv.FormatInt(p.UserID, 10))))
+
+			if err := s.writeFile(ctx, p, os.Link); err != nil {
+				t.Fatalf("write legacy page: %v", err)
+			}
+		}
+
+		if err := s.Init(ctx); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(s.basePath, canonicalMarker)); err != nil {
+			t.Fatalf("Init left no marker: %v", err)
+		}
+	})
+}
+
+func TestLegacyPage(t *testing.T) {
+	// legacyPage mirrors storage.Page as written by the first files backend,
+	// which kept pages in a directory named after the username.
+	type legacyPage struct {
+		URL      string
+		UserName string
+	}
+
+	const userID = 42
+
+	ctx := context.Background()
+	base := t.TempDir()
+	legacy := legacyPage{URL: "https://example.com/a", UserName: "alice"}
+
+	dir := filepath.Join(base, legacy.UserName)
+	if err := os.MkdirAll(dir, defaultPerm); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%x", sha1.Sum([]byte(legacy.URL+legacy.UserName)))))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := gob.NewEncoder(f).Encode(legacy); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	_ = f.Close()
+
+	s := New(base)
+
+	if err := s.MigrateUser(ctx, legacy.UserName, userID); err != nil {
+		t.Fatalf("MigrateUser: %v", err)
+	}
+
+	p, err := s.PickRandom(ctx, userID, storage.Filter{})
+	if err != nil {
+		t.Fatalf("PickRandom: %v", err)
+	}
+
+	if p.URL != legacy.URL || p.UserID != userID || p.UserName != legacy.UserName || p.ID == "" || p.SavedAt.IsZero() {
+		t.Fatalf("PickRandom = %+v, want legacy page with user ID, ID and SavedAt", p)
+	}
+
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("legacy directory left behind: %v", err)
+	}
+
+	if err := s.MigrateUser(ctx, legacy.UserName, userID); err != nil {
+		t.Fatalf("MigrateUser again: %v", err)
+	}
+}
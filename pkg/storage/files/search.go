@@ -0,0 +1,194 @@
+package files
+
+import (
+	"cmp"
+	"context"
+	"go_link_storage/pkg/lib/e"
+	"go_link_storage/pkg/storage"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Weights of the page fields in search scores.
+const (
+	titleWeight       = 10
+	tagsWeight        = 5
+	descriptionWeight = 2
+	noteWeight        = 2
+	urlWeight         = 1
+)
+
+// searchIndex keeps an inverted index of the pages of every user that has searched.
+// A user's index is built from the files on the first search and dropped
+// whenever a page of the user changes, so it never outlives the files it was
+// built from within the process.
+type searchIndex struct {
+	mu    sync.Mutex           // Guards users
+	users map[int64]*userIndex // Indexes by user ID
+}
+
+// userIndex is the inverted index of the pages of one user.
+type userIndex struct {
+	pages    map[string]*storage.Page  // Indexed pages by ID
+	postings map[string]map[string]int // Page IDs and weights by term
+	terms    []string                  // Indexed terms, sorted for prefix lookups
+}
+
+// newSearchIndex creates an empty index.
+func newSearchIndex() *searchIndex {
+	return &searchIndex{users: make(map[int64]*userIndex)}
+}
+
+// invalidate drops the index of the user, so the next search rebuilds it.
+func (x *searchIndex) invalidate(userID int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	delete(x.users, userID)
+}
+
+// Search returns a page of the user's pages matching every term of query, best matches first.
+// Each term matches indexed words starting with it; a page scores the weights of
+// the fields the matched words occur in.
+func (s Storage) Search(ctx context.Context, userID int64, query string, offset, limit int) (pages []*storage.Page, err error) {
+	defer func() { err = e.WrapIfErr("cannot search pages", err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	terms := storage.SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	idx, err := s.userIndex(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := idx.match(terms)
+
+	// The indexed pages are copied, so callers cannot change the index.
+	pages = make([]*storage.Page, 0, len(scores))
+	for id := range scores {
+		page := *idx.pages[id]
+		pages = append(pages, &page)
+	}
+
+	slices.SortFunc(pages, func(a, b *storage.Page) int {
+		return cmp.Or(
+			cmp.Compare(scores[b.ID], scores[a.ID]),
+			b.SavedAt.Compare(a.SavedAt),
+			strings.Compare(b.ID, a.ID),
+		)
+	})
+
+	if offset >= len(pages) {
+		return nil, nil
+	}
+
+	return pages[offset:min(offset+limit, len(pages))], nil
+}
+
+// userIndex returns the index of the user, building it if there is none.
+// The lock is held while building, so concurrent searches build it once.
+func (s Storage) userIndex(ctx context.Context, userID int64) (*userIndex, error) {
+	s.index.mu.Lock()
+	defer s.index.mu.Unlock()
+
+	if idx, ok := s.index.users[userID]; ok {
+		return idx, nil
+	}
+
+	pages, err := s.userPages(ctx, userID, storage.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	idx := buildIndex(pages)
+	s.index.users[userID] = idx
+
+	return idx, nil
+}
+
+// buildIndex indexes the searchable fields of pages.
+func buildIndex(pages []*storage.Page) *userIndex {
+	idx := &userIndex{
+		pages:    make(map[string]*storage.Page, len(pages)),
+		postings: make(map[string]map[string]int),
+	}
+
+	for _, p := range pages {
+		idx.pages[p.ID] = p
+
+		fields := []struct {
+			text   string
+			weight int
+		}{
+			{p.Title, titleWeight},
+			{strings.Join(p.Tags, " "), tagsWeight},
+			{p.Description, descriptionWeight},
+			{p.Note, noteWeight},
+			{p.URL, urlWeight},
+		}
+
+		for _, f := range fields {
+			for _, term := range storage.SearchTerms(f.text) {
+				if idx.postings[term] == nil {
+					idx.postings[term] = make(map[string]int)
+				}
+
+				idx.postings[term][p.ID] += f.weight
+			}
+		}
+	}
+
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+	}
+
+	slices.Sort(idx.terms)
+
+	return idx
+}
+
+// match returns the scores of the pages matching every term.
+func (idx *userIndex) match(terms []string) map[string]int {
+	var res map[string]int
+
+	for _, term := range terms {
+		scores := idx.matchPrefix(term)
+
+		if res == nil {
+			res = scores
+			continue
+		}
+
+		for id := range res {
+			if score, ok := scores[id]; ok {
+				res[id] += score
+			} else {
+				delete(res, id)
+			}
+		}
+	}
+
+	return res
+}
+
+// matchPrefix returns the scores of the pages containing a word starting with prefix.
+func (idx *userIndex) matchPrefix(prefix string) map[string]int {
+	res := make(map[string]int)
+
+	i, _ := slices.BinarySearch(idx.terms, prefix)
+
+	for ; i < len(idx.terms) && strings.HasPrefix(idx.terms[i], prefix); i++ {
+		for id, weight := range idx.postings[idx.terms[i]] {
+			res[id] += weight
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,191 @@
+// Package migrate applies versioned schema migrations to the SQL storage backends.
+// Migrations are plain SQL files named NNNN_description.up.sql; every backend
+// embeds its own dialect-specific set and passes it to Up. Changes that cannot
+// be expressed in SQL are passed to Up as Go migrations.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go_link_storage/pkg/lib/e"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Dialect describes the SQL flavour differences the runner has to care about.
+type Dialect int
+
+const (
+	SQLite   Dialect = iota // SQLite, uses ? placeholders
+	Postgres                // PostgreSQL, uses $N placeholders
+)
+
+// Migration is a single schema change.
+type Migration struct {
+	Version int    // Unique, increasing migration number
+	Name    string // Human-readable description taken from the file name
+	SQL     string // Statements applied by the migration
+	// Func applies a Go migration instead of SQL. It runs in the transaction
+	// that records the migration.
+	Func func(ctx context.Context, tx *sql.Tx) error
+}
+
+// fileRe matches migration file names and captures version and name.
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.up\.sql$`)
+
+// Up applies every migration from fsys and funcs that is not yet recorded in
+// the schema_migrations table, in version order. Each migration runs in its
+// own transaction together with the insert that records it.
+func Up(ctx context.Context, db *sql.DB, fsys fs.FS, d Dialect, funcs ...Migration) (err error) {
+	defer func() { err = e.WrapIfErr("cannot migrate", err) }()
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		return err
+	}
+
+	migrations = append(migrations, funcs...)
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i := 1; i < len(migrations); i++ {
+		if prev, m := migrations[i-1], migrations[i]; prev.Version == m.Version {
+			return fmt.Errorf("duplicate migration version %d: %s and %s", m.Version, prev.Name, m.Name)
+		}
+	}
+
+	q := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return e.Wrap("cannot create schema_migrations", err)
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		if err := apply(ctx, db, m, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load reads migrations from the root of fsys and returns them ordered by version.
+// Files that do not look like migrations are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, e.Wrap("cannot read migrations", err)
+	}
+
+	var res []Migration
+
+	seen := make(map[int]string, len(entries))
+
+	for _, entry := range entries {
+		m := fileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, e.Wrap("cannot parse migration version", err)
+		}
+
+		if prev, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, prev, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, e.Wrap("cannot read migration", err)
+		}
+
+		res = append(res, Migration{Version: version, Name: m[2], SQL: string(data)})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+
+	return res, nil
+}
+
+// appliedVersions returns the set of versions recorded in schema_migrations.
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations;`)
+	if err != nil {
+		return nil, e.Wrap("cannot select applied migrations", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	res := make(map[int]bool)
+
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, e.Wrap("cannot scan migration version", err)
+		}
+
+		res[v] = true
+	}
+
+	return res, rows.Err()
+}
+
+// apply runs a single migration and records it in one transaction.
+func apply(ctx context.Context, db *sql.DB, m Migration, d Dialect) (err error) {
+	defer func() { err = e.WrapIfErr(fmt.Sprintf("cannot apply migration %d_%s", m.Version, m.Name), err) }()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if m.Func != nil {
+		err = m.Func(ctx, tx)
+	} else {
+		_, err = tx.ExecContext(ctx, m.SQL)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	q := fmt.Sprintf(`INSERT INTO schema_migrations (version, name) VALUES (%s, %s);`, d.bind(1), d.bind(2))
+
+	if _, err := tx.ExecContext(ctx, q, m.Version, m.Name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// bind returns the placeholder for the n-th query argument.
+func (d Dialect) bind(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+
+	return "?"
+}
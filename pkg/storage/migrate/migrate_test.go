@@ -0,0 +1,207 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestDB opens an empty SQLite database that is closed when the test ends.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("cannot open database: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+// recorded returns the versions recorded in schema_migrations, ascending.
+func recorded(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+
+	applied, err := appliedVersions(context.Background(), db)
+	if err != nil {
+		t.Fatalf("appliedVersions: %v", err)
+	}
+
+	var res []int
+	for v := range applied {
+		res = append(res, v)
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+// tableExists reports whether the database has the named table.
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var n int
+
+	q := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?;`
+	if err := db.QueryRow(q, name).Scan(&n); err != nil {
+		t.Fatalf("cannot look up table %s: %v", name, err)
+	}
+
+	return n > 0
+}
+
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	errBroken := errors.New("broken migration")
+
+	tests := []struct {
+		name  string
+		fsys  fstest.MapFS
+		funcs []Migration
+	}{
+		{
+			name: "sql",
+			fsys: fstest.MapFS{
+				"0002_broken.up.sql": {Data: []byte(`CREATE TABLE tags (name TEXT); INSERT INTO missing VALUES (1);`)},
+			},
+		},
+		{
+			name: "go",
+			funcs: []Migration{{Version: 2, Name: "broken", Func: func(ctx context.Context, tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, `CREATE TABLE tags (name TEXT);`); err != nil {
+					return err
+				}
+
+				return errBroken
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t)
+
+			fsys := fstest.MapFS{"0001_pages.up.sql": {Data: []byte(`CREATE TABLE pages (url TEXT);`)}}
+			for name, f := range tt.fsys {
+				fsys[name] = f
+			}
+
+			err := Up(ctx, db, fsys, SQLite, tt.funcs...)
+			if err == nil {
+				t.Fatal("Up() succeeded with a broken migration")
+			}
+
+			if tt.funcs != nil && !errors.Is(err, errBroken) {
+				t.Errorf("Up() error = %v, want %v", err, errBroken)
+			}
+
+			if !strings.Contains(err.Error(), "2_broken") {
+				t.Errorf("Up() error = %v, want it to name the broken migration", err)
+			}
+
+			// The migrations before the broken one stay applied.
+			if got, want := recorded(t, db), []int{1}; !slices.Equal(got, want) {
+				t.Errorf("recorded versions = %v, want %v", got, want)
+			}
+
+			if !tableExists(t, db, "pages") {
+				t.Error("table of the applied migration is missing")
+			}
+
+			if tableExists(t, db, "tags") {
+				t.Error("table of the broken migration was not rolled back")
+			}
+		})
+	}
+}
+
+func TestUpRejectsDuplicateVersions(t *testing.T) {
+	tests := []struct {
+		name  string
+		fsys  fstest.MapFS
+		funcs []Migration
+	}{
+		{
+			name: "files",
+			fsys: fstest.MapFS{
+				"0001_pages.up.sql": {Data: []byte(`CREATE TABLE pages (url TEXT);`)},
+				"01_tags.up.sql":    {Data: []byte(`CREATE TABLE tags (name TEXT);`)},
+			},
+		},
+		{
+			name: "file and go",
+			fsys: fstest.MapFS{
+				"0001_pages.up.sql": {Data: []byte(`CREATE TABLE pages (url TEXT);`)},
+			},
+			funcs: []Migration{{Version: 1, Name: "tags", Func: func(context.Context, *sql.Tx) error { return nil }}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+
+			err := Up(context.Background(), db, tt.fsys, SQLite, tt.funcs...)
+			if err == nil || !strings.Contains(err.Error(), "duplicate migration version 1") {
+				t.Fatalf("Up() error = %v, want a duplicate version error", err)
+			}
+
+			// Nothing is applied when the set of migrations is ambiguous.
+			if tableExists(t, db, "pages") {
+				t.Error("migration applied despite the duplicate version")
+			}
+		})
+	}
+}
+
+func TestUpSkipsAppliedMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	// Applying a migration twice fails, since the table already exists.
+	fsys := fstest.MapFS{
+		"0001_pages.up.sql": {Data: []byte(`CREATE TABLE pages (url TEXT);`)},
+		"0003_tags.up.sql":  {Data: []byte(`CREATE TABLE tags (name TEXT);`)},
+		"README.md":         {Data: []byte(`not a migration`)},
+	}
+
+	calls := 0
+	backfill := Migration{Version: 2, Name: "backfill", Func: func(ctx context.Context, tx *sql.Tx) error {
+		calls++
+		_, err := tx.ExecContext(ctx, `INSERT INTO pages (url) VALUES ('https://example.com');`)
+		return err
+	}}
+
+	if err := Up(ctx, db, fsys, SQLite, backfill); err != nil {
+		t.Fatalf("first Up: %v", err)
+	}
+
+	// A new migration shipped with the next release is applied on its own.
+	fsys["0004_users.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE users (id INTEGER);`)}
+
+	if err := Up(ctx, db, fsys, SQLite, backfill); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("go migration ran %d times, want 1", calls)
+	}
+
+	if got, want := recorded(t, db), []int{1, 2, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("recorded versions = %v, want %v", got, want)
+	}
+
+	if !tableExists(t, db, "users") {
+		t.Error("new migration was not applied")
+	}
+}
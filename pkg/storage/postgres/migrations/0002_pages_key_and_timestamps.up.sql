@@ -0,0 +1,12 @@
+ALTER TABLE pages ADD COLUMN id BIGSERIAL PRIMARY KEY;
+ALTER TABLE pages ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Drop rows with missing values and duplicates left by older versions.
+DELETE FROM pages WHERE url IS NULL OR user_name IS NULL;
+DELETE FROM pages a USING pages b
+WHERE a.id > b.id AND a.url = b.url AND a.user_name = b.user_name;
+
+ALTER TABLE pages
+    ALTER COLUMN url SET NOT NULL,
+    ALTER COLUMN user_name SET NOT NULL,
+    ADD CONSTRAINT pages_user_name_url_key UNIQUE (user_name, url);
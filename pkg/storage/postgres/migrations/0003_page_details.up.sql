@@ -0,0 +1,6 @@
+ALTER TABLE pages
+    ADD COLUMN title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tags TEXT NOT NULL DEFAULT '[]',
+    ADD COLUMN note TEXT NOT NULL DEFAULT '',
+    ADD COLUMN read_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE pages
+    ADD COLUMN source_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN source_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Pages are keyed by the Telegram user ID instead of the username.
+-- Rows saved by older versions keep a NULL user_id until MigrateUser
+-- assigns them to the user who owns the username.
+ALTER TABLE pages
+    ADD COLUMN user_id BIGINT,
+    DROP CONSTRAINT pages_user_name_url_key,
+    ADD CONSTRAINT pages_user_id_url_key UNIQUE (user_id, url);
+
+CREATE INDEX pages_legacy_user_name_idx ON pages (user_name) WHERE user_id IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE pages
+    ADD COLUMN site_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Full-text search document of a page. Punctuation is replaced with spaces
+-- first, so URLs and the JSON tags array split into plain words. Weights make
+-- title matches rank above tags, description and note, and those above the URL.
+ALTER TABLE pages ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', regexp_replace(title, '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+    setweight(to_tsvector('simple', regexp_replace(tags, '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+    setweight(to_tsvector('simple', regexp_replace(description || ' ' || note, '[^[:alnum:]]+', ' ', 'g')), 'C') ||
+    setweight(to_tsvector('simple', regexp_replace(url, '[^[:alnum:]]+', ' ', 'g')), 'D')
+) STORED;
+
+CREATE INDEX pages_search_idx ON pages USING GIN (search);
@@ -0,0 +1,27 @@
+-- Tags of pages, shared by every user. page_tags is the source of truth for
+-- filtering and counting; pages.tags keeps a JSON copy of the page's tag
+-- names for the search column.
+CREATE TABLE tags (
+    id   BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE page_tags (
+    page_id BIGINT NOT NULL REFERENCES pages (id) ON DELETE CASCADE,
+    tag_id  BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (page_id, tag_id)
+);
+
+CREATE INDEX page_tags_tag_id_idx ON page_tags (tag_id);
+
+INSERT INTO tags (name)
+SELECT DISTINCT t.name FROM pages
+CROSS JOIN LATERAL jsonb_array_elements_text(pages.tags::jsonb) AS t (name)
+WHERE t.name <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO page_tags (page_id, tag_id)
+SELECT DISTINCT pages.id, tags.id FROM pages
+CROSS JOIN LATERAL jsonb_array_elements_text(pages.tags::jsonb) AS t (name)
+JOIN tags ON tags.name = t.name
+ON CONFLICT (page_id, tag_id) DO NOTHING;
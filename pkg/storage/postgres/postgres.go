@@ -1,28 +1,41 @@
+// Package postgres provides a PostgreSQL implementation of the storage.Storage interface.
 package postgres
 
 import (
 	"context"
 	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/migrate"
+	"go_link_storage/pkg/urlnorm"
+	"io/fs"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
-// Storage implements the storage.Storage interface using SQLite database.
+//go:embed migrations/*.sql
+var migrations embed.FS // Dialect-specific schema migrations
+
+// pageColumns lists the columns scanned by scanPage, in order.
+const pageColumns = `id, url, user_id, user_name, created_at, title, description, tags, note, read_at, source_name, source_url, site_name, image_url`
+
+// deadLetterColumns lists the columns scanned by scanDeadLetter, in order.
+const deadLetterColumns = `id, payload, error, attempts, failed_at, next_attempt_at`
+
+// Storage implements the storage.Storage interface using PostgreSQL database.
 type Storage struct {
-	db *sql.DB // SQLite database connection
+	db *sql.DB // PostgreSQL database connection
 }
 
-// New creates a new SQLite storage instance.
-// It opens a connection to the database at the given path and verifies connectivity.
-func New(host, port, user, password, dbName string) (*Storage, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbName,
-	)
-
+// New creates a new PostgreSQL storage instance.
+// It opens a connection using the given DSN and waits until the server is reachable.
+func New(dsn string) (*Storage, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open postgres connection: %w", err)
@@ -46,69 +59,761 @@ func New(host, port, user, password, dbName string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
-// Save stores a page in the SQLite database.
-func (s *Storage) Save(ctx context.Context, p *storage.Page) error {
-	q := `INSERT INTO pages (url, user_name) VALUES ($1, $2);`
+// Save stores a page in the PostgreSQL database.
+// Saving a page that already exists for the user is a no-op.
+// On insert the canonical URL, the normalized tags, the generated ID and SavedAt are written back to p.
+func (s *Storage) Save(ctx context.Context, p *storage.Page) (err error) {
+	q := `INSERT INTO pages (url, user_id, user_name, created_at, title, description, tags, note, read_at, source_name, source_url, site_name, image_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (user_id, url) DO NOTHING
+		RETURNING id;`
+
+	url := urlnorm.Normalize(p.URL)
+
+	savedAt := p.SavedAt
+	if savedAt.IsZero() {
+		savedAt = time.Now().UTC()
+	}
+
+	tags := storage.NormalizeTags(p.Tags)
+
+	encoded, err := json.Marshal(nonNil(tags))
+	if err != nil {
+		return fmt.Errorf("cannot encode tags: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
 
-	if _, err := s.db.ExecContext(ctx, q, p.URL, p.UserName); err != nil {
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var id int64
+
+	err = tx.QueryRowContext(ctx, q,
+		url, p.UserID, p.UserName, savedAt, p.Title, p.Description, string(encoded), p.Note, nullTime(p.ReadAt),
+		p.SourceName, p.SourceURL, p.SiteName, p.ImageURL,
+	).Scan(&id)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// The deferred rollback only runs on errors.
+		return tx.Rollback()
+	case err != nil:
 		return fmt.Errorf("cannot save page: %w", err)
 	}
 
+	if err := linkTags(ctx, tx, id, tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	p.URL = url
+	p.Tags = tags
+	p.ID = strconv.FormatInt(id, 10)
+	p.SavedAt = savedAt
+
 	return nil
 }
 
-// PickRandom retrieves a random page for the given user from the database.
-func (s *Storage) PickRandom(ctx context.Context, userName string) (*storage.Page, error) {
-	q := `SELECT url FROM pages WHERE user_name = $1 ORDER BY RANDOM() LIMIT 1;`
+// PickRandom retrieves a random page matching f for the given user from the database.
+func (s *Storage) PickRandom(ctx context.Context, userID int64, f storage.Filter) (*storage.Page, error) {
+	w := newWhere(userID, f)
 
-	var url string
+	q := `SELECT ` + pageColumns + ` FROM pages WHERE ` + w.String() + ` ORDER BY RANDOM() LIMIT 1;`
 
-	err := s.db.QueryRowContext(ctx, q, userName).Scan(&url)
-	if err == sql.ErrNoRows {
+	p, err := scanPage(s.db.QueryRowContext(ctx, q, w.args...))
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, storage.ErrNoSavedPages
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("cannot select url: %w", err)
+		return nil, fmt.Errorf("cannot select page: %w", err)
 	}
 
-	return &storage.Page{
-		URL:      url,
-		UserName: userName,
-	}, nil
+	return p, nil
 }
 
-// Remove deletes a page from the SQLite database.
+// Remove deletes a page from the PostgreSQL database.
 func (s *Storage) Remove(ctx context.Context, p *storage.Page) error {
-	q := `DELETE FROM pages WHERE url = $1 AND user_name = $2;`
+	q := `DELETE FROM pages WHERE url = $1 AND user_id = $2;`
 
-	if _, err := s.db.ExecContext(ctx, q, p.URL, p.UserName); err != nil {
+	if _, err := s.db.ExecContext(ctx, q, urlnorm.Normalize(p.URL), p.UserID); err != nil {
 		return fmt.Errorf("cannot remove page: %w", err)
 	}
 
 	return nil
 }
 
-// Exists checks if a page already exists in the SQLite database.
+// Exists checks if a page already exists in the PostgreSQL database.
 func (s *Storage) Exists(ctx context.Context, p *storage.Page) (bool, error) {
-	q := `SELECT COUNT(url) FROM pages WHERE url = $1 AND user_name = $2;`
+	q := `SELECT COUNT(*) FROM pages WHERE url = $1 AND user_id = $2;`
 
 	var count int
 
-	if err := s.db.QueryRowContext(ctx, q, p.URL, p.UserName).Scan(&count); err != nil {
+	if err := s.db.QueryRowContext(ctx, q, urlnorm.Normalize(p.URL), p.UserID).Scan(&count); err != nil {
 		return false, fmt.Errorf("cannot select url: %w", err)
 	}
 
 	return count > 0, nil
 }
 
+// List returns a page of the user's saved pages matching f from the PostgreSQL database, newest first.
+func (s *Storage) List(ctx context.Context, userID int64, f storage.Filter, offset, limit int) ([]*storage.Page, error) {
+	w := newWhere(userID, f)
+
+	q := `SELECT ` + pageColumns + ` FROM pages WHERE ` + w.String() +
+		` ORDER BY created_at DESC, id DESC LIMIT ` + w.bind(limit) + ` OFFSET ` + w.bind(offset) + `;`
+
+	pages, err := selectPages(ctx, s.db, q, w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pages: %w", err)
+	}
+
+	return pages, nil
+}
+
+// Search returns a page of the user's pages matching every term of query, best matches first.
+// Terms are matched as prefixes against the search column; ts_rank weighs title matches
+// above tags, description and note, and those above the URL.
+func (s *Storage) Search(ctx context.Context, userID int64, query string, offset, limit int) ([]*storage.Page, error) {
+	match := tsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	q := `SELECT ` + pageColumns + ` FROM pages, to_tsquery('simple', $1) AS query
+		WHERE user_id = $2 AND search @@ query
+		ORDER BY ts_rank(search, query) DESC, created_at DESC, id DESC LIMIT $3 OFFSET $4;`
+
+	pages, err := selectPages(ctx, s.db, q, match, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot search pages: %w", err)
+	}
+
+	return pages, nil
+}
+
+// SetReadAt updates the read time of the page identified by p.ID and p.UserID.
+func (s *Storage) SetReadAt(ctx context.Context, p *storage.Page, readAt time.Time) error {
+	q := `UPDATE pages SET read_at = $1 WHERE id = $2 AND user_id = $3;`
+
+	id, err := strconv.ParseInt(p.ID, 10, 64)
+	if err != nil {
+		return storage.ErrPageNotFound
+	}
+
+	res, err := s.db.ExecContext(ctx, q, nullTime(readAt), id, p.UserID)
+	if err != nil {
+		return fmt.Errorf("cannot update page: %w", err)
+	}
+
+	if err := checkPageAffected(res); err != nil {
+		return err
+	}
+
+	p.ReadAt = readAt
+
+	return nil
+}
+
+// SetPreview updates the preview fields of the page identified by p.ID and p.UserID.
+func (s *Storage) SetPreview(ctx context.Context, p *storage.Page) error {
+	q := `UPDATE pages SET title = $1, description = $2, site_name = $3, image_url = $4
+		WHERE id = $5 AND user_id = $6;`
+
+	id, err := strconv.ParseInt(p.ID, 10, 64)
+	if err != nil {
+		return storage.ErrPageNotFound
+	}
+
+	res, err := s.db.ExecContext(ctx, q, p.Title, p.Description, p.SiteName, p.ImageURL, id, p.UserID)
+	if err != nil {
+		return fmt.Errorf("cannot update page: %w", err)
+	}
+
+	return checkPageAffected(res)
+}
+
+// AddTags adds tags to the page identified by p.ID and p.UserID
+// and writes the resulting tags back to p.
+func (s *Storage) AddTags(ctx context.Context, p *storage.Page, tags []string) (err error) {
+	id, err := strconv.ParseInt(p.ID, 10, 64)
+	if err != nil {
+		return storage.ErrPageNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `SELECT tags FROM pages WHERE id = $1 AND user_id = $2 FOR UPDATE;`
+
+	var stored string
+
+	err = tx.QueryRowContext(ctx, q, id, p.UserID).Scan(&stored)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return storage.ErrPageNotFound
+	case err != nil:
+		return fmt.Errorf("cannot select page: %w", err)
+	}
+
+	var current []string
+	if err := json.Unmarshal([]byte(stored), &current); err != nil {
+		return fmt.Errorf("cannot decode tags: %w", err)
+	}
+
+	merged := storage.NormalizeTags(append(current, tags...))
+
+	encoded, err := json.Marshal(nonNil(merged))
+	if err != nil {
+		return fmt.Errorf("cannot encode tags: %w", err)
+	}
+
+	q = `UPDATE pages SET tags = $1 WHERE id = $2;`
+
+	if _, err := tx.ExecContext(ctx, q, string(encoded), id); err != nil {
+		return fmt.Errorf("cannot update page: %w", err)
+	}
+
+	if err := linkTags(ctx, tx, id, merged); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	p.Tags = merged
+
+	return nil
+}
+
+// Tags returns the tags of the user's pages with the number of pages carrying each, most used first.
+func (s *Storage) Tags(ctx context.Context, userID int64) ([]storage.TagCount, error) {
+	q := `SELECT tags.name, COUNT(*) FROM page_tags
+		JOIN tags ON tags.id = page_tags.tag_id
+		JOIN pages ON pages.id = page_tags.page_id
+		WHERE pages.user_id = $1
+		GROUP BY tags.name
+		ORDER BY COUNT(*) DESC, tags.name;`
+
+	rows, err := s.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot count tags: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []storage.TagCount
+
+	for rows.Next() {
+		var t storage.TagCount
+		if err := rows.Scan(&t.Name, &t.Pages); err != nil {
+			return nil, fmt.Errorf("cannot scan tag: %w", err)
+		}
+
+		res = append(res, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot count tags: %w", err)
+	}
+
+	return res, nil
+}
+
+// MigrateUser moves the pages older versions saved under userName to userID.
+// Legacy rows the user has already saved under userID are dropped.
+func (s *Storage) MigrateUser(ctx context.Context, userName string, userID int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	q := `DELETE FROM pages
+		WHERE user_id IS NULL AND user_name = $1
+		AND url IN (SELECT url FROM pages WHERE user_id = $2);`
+
+	if _, err := tx.ExecContext(ctx, q, userName, userID); err != nil {
+		return fmt.Errorf("cannot drop duplicate pages: %w", err)
+	}
+
+	q = `UPDATE pages SET user_id = $1 WHERE user_id IS NULL AND user_name = $2;`
+
+	if _, err := tx.ExecContext(ctx, q, userID, userName); err != nil {
+		return fmt.Errorf("cannot migrate pages: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Offset returns the stored offset of the named stream, or 0 if none is stored.
+func (s *Storage) Offset(ctx context.Context, name string) (int, error) {
+	q := `SELECT value FROM offsets WHERE name = $1;`
+
+	var offset int
+
+	err := s.db.QueryRowContext(ctx, q, name).Scan(&offset)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("cannot select offset: %w", err)
+	}
+
+	return offset, nil
+}
+
+// SetOffset stores the offset of the named stream, replacing the previous one.
+func (s *Storage) SetOffset(ctx context.Context, name string, offset int) error {
+	q := `INSERT INTO offsets (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value;`
+
+	if _, err := s.db.ExecContext(ctx, q, name, offset); err != nil {
+		return fmt.Errorf("cannot save offset: %w", err)
+	}
+
+	return nil
+}
+
+// AddDeadLetter stores a new dead letter and writes the assigned ID back to d.
+func (s *Storage) AddDeadLetter(ctx context.Context, d *storage.DeadLetter) error {
+	q := `INSERT INTO dead_letters (payload, error, attempts, failed_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id;`
+
+	var id int64
+
+	err := s.db.QueryRowContext(ctx, q, d.Payload, d.Error, d.Attempts, d.FailedAt, nullTime(d.NextAttemptAt)).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("cannot save dead letter: %w", err)
+	}
+
+	d.ID = strconv.FormatInt(id, 10)
+
+	return nil
+}
+
+// UpdateDeadLetter saves Error, Attempts and NextAttemptAt of the dead letter identified by d.ID.
+func (s *Storage) UpdateDeadLetter(ctx context.Context, d *storage.DeadLetter) error {
+	q := `UPDATE dead_letters SET error = $1, attempts = $2, next_attempt_at = $3 WHERE id = $4;`
+
+	id, err := strconv.ParseInt(d.ID, 10, 64)
+	if err != nil {
+		return storage.ErrDeadLetterNotFound
+	}
+
+	res, err := s.db.ExecContext(ctx, q, d.Error, d.Attempts, nullTime(d.NextAttemptAt), id)
+	if err != nil {
+		return fmt.Errorf("cannot update dead letter: %w", err)
+	}
+
+	return checkDeadLetterAffected(res)
+}
+
+// RemoveDeadLetter deletes the dead letter with the given ID.
+func (s *Storage) RemoveDeadLetter(ctx context.Context, id string) error {
+	q := `DELETE FROM dead_letters WHERE id = $1;`
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return storage.ErrDeadLetterNotFound
+	}
+
+	res, err := s.db.ExecContext(ctx, q, n)
+	if err != nil {
+		return fmt.Errorf("cannot remove dead letter: %w", err)
+	}
+
+	return checkDeadLetterAffected(res)
+}
+
+// DeadLetter returns the dead letter with the given ID.
+func (s *Storage) DeadLetter(ctx context.Context, id string) (*storage.DeadLetter, error) {
+	q := `SELECT ` + deadLetterColumns + ` FROM dead_letters WHERE id = $1;`
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, storage.ErrDeadLetterNotFound
+	}
+
+	d, err := scanDeadLetter(s.db.QueryRowContext(ctx, q, n))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, storage.ErrDeadLetterNotFound
+	case err != nil:
+		return nil, fmt.Errorf("cannot select dead letter: %w", err)
+	}
+
+	return d, nil
+}
+
+// DeadLetters returns up to limit dead letters, all of them or only those due by due.
+func (s *Storage) DeadLetters(ctx context.Context, due time.Time, limit int) ([]*storage.DeadLetter, error) {
+	q := `SELECT ` + deadLetterColumns + ` FROM dead_letters ORDER BY failed_at, id LIMIT $1;`
+	args := []any{limit}
+
+	if !due.IsZero() {
+		q = `SELECT ` + deadLetterColumns + ` FROM dead_letters
+			WHERE next_attempt_at <= $1
+			ORDER BY next_attempt_at, id LIMIT $2;`
+		args = []any{due, limit}
+	}
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list dead letters: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []*storage.DeadLetter
+
+	for rows.Next() {
+		d, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list dead letters: %w", err)
+		}
+
+		res = append(res, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot list dead letters: %w", err)
+	}
+
+	return res, nil
+}
+
+// Close closes the database connection.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Init brings the database schema up to date by applying pending migrations.
 func (s *Storage) Init(ctx context.Context) error {
-	q := `CREATE TABLE IF NOT EXISTS pages (url TEXT, user_name TEXT);`
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return fmt.Errorf("cannot open migrations: %w", err)
+	}
+
+	return migrate.Up(ctx, s.db, sub, migrate.Postgres, canonicalURLs)
+}
+
+// canonicalURLs is the Go migration that brings the URLs saved before
+// canonicalization to their canonical form.
+var canonicalURLs = migrate.Migration{Version: 11, Name: "canonical_urls", Func: canonicalizeURLs}
+
+// canonicalizeURLs rewrites every stored URL that is not canonical.
+// Rows that turn out to hold the same page of one user, or of one username
+// for rows not migrated to user IDs yet, are merged: the page stored first
+// under the canonical URL is kept and gets the tags of the others.
+func canonicalizeURLs(ctx context.Context, tx *sql.Tx) error {
+	type row struct {
+		id       int64
+		url      string
+		userID   sql.NullInt64
+		userName string
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, url, user_id, user_name FROM pages ORDER BY id;`)
+	if err != nil {
+		return fmt.Errorf("cannot select pages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stale []row
 
-	_, err := s.db.ExecContext(ctx, q)
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.url, &r.userID, &r.userName); err != nil {
+			return fmt.Errorf("cannot scan page: %w", err)
+		}
+
+		if urlnorm.Normalize(r.url) != r.url {
+			stale = append(stale, r)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot select pages: %w", err)
+	}
+
+	for _, r := range stale {
+		url := urlnorm.Normalize(r.url)
+
+		q := `SELECT id FROM pages WHERE url = $1 AND user_id IS NOT DISTINCT FROM $2 AND (user_id IS NOT NULL OR user_name = $3) AND id <> $4 ORDER BY id LIMIT 1;`
+
+		var keep int64
+
+		err := tx.QueryRowContext(ctx, q, url, r.userID, r.userName, r.id).Scan(&keep)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if _, err := tx.ExecContext(ctx, `UPDATE pages SET url = $1 WHERE id = $2;`, url, r.id); err != nil {
+				return fmt.Errorf("cannot update page: %w", err)
+			}
+
+			continue
+		case err != nil:
+			return fmt.Errorf("cannot select page: %w", err)
+		}
+
+		if err := mergePages(ctx, tx, keep, r.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergePages adds the tags of the page drop to the page keep and deletes drop.
+func mergePages(ctx context.Context, tx *sql.Tx, keep, drop int64) error {
+	var merged []string
+
+	for _, id := range []int64{keep, drop} {
+		var stored string
+
+		if err := tx.QueryRowContext(ctx, `SELECT tags FROM pages WHERE id = $1;`, id).Scan(&stored); err != nil {
+			return fmt.Errorf("cannot select page: %w", err)
+		}
+
+		var tags []string
+		if err := json.Unmarshal([]byte(stored), &tags); err != nil {
+			return fmt.Errorf("cannot decode tags: %w", err)
+		}
+
+		merged = append(merged, tags...)
+	}
+
+	merged = storage.NormalizeTags(merged)
+
+	encoded, err := json.Marshal(nonNil(merged))
 	if err != nil {
-		return fmt.Errorf("cannot create table: %w", err)
+		return fmt.Errorf("cannot encode tags: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE pages SET tags = $1 WHERE id = $2;`, string(encoded), keep); err != nil {
+		return fmt.Errorf("cannot update page: %w", err)
+	}
+
+	if err := linkTags(ctx, tx, keep, merged); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pages WHERE id = $1;`, drop); err != nil {
+		return fmt.Errorf("cannot remove page: %w", err)
 	}
 
 	return nil
 }
+
+// scanPage reads a row selected with pageColumns into a Page.
+func scanPage(row interface{ Scan(dest ...any) error }) (*storage.Page, error) {
+	var (
+		p      storage.Page
+		id     int64
+		userID sql.NullInt64
+		tags   string
+		readAt sql.NullTime
+	)
+
+	err := row.Scan(&id, &p.URL, &userID, &p.UserName, &p.SavedAt, &p.Title, &p.Description, &tags, &p.Note, &readAt,
+		&p.SourceName, &p.SourceURL, &p.SiteName, &p.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(tags), &p.Tags); err != nil {
+		return nil, fmt.Errorf("cannot decode tags: %w", err)
+	}
+
+	p.ID = strconv.FormatInt(id, 10)
+	p.UserID = userID.Int64
+	p.ReadAt = readAt.Time
+
+	return &p, nil
+}
+
+// linkTags links the page to tags in page_tags, creating the tags that do not exist yet.
+// Links the page already has are kept.
+func linkTags(ctx context.Context, tx *sql.Tx, pageID int64, tags []string) error {
+	for _, tag := range tags {
+		q := `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING;`
+
+		if _, err := tx.ExecContext(ctx, q, tag); err != nil {
+			return fmt.Errorf("cannot save tag: %w", err)
+		}
+
+		q = `INSERT INTO page_tags (page_id, tag_id)
+			SELECT $1, id FROM tags WHERE name = $2
+			ON CONFLICT (page_id, tag_id) DO NOTHING;`
+
+		if _, err := tx.ExecContext(ctx, q, pageID, tag); err != nil {
+			return fmt.Errorf("cannot tag page: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// selectPages runs a query selecting pageColumns and scans every row.
+func selectPages(ctx context.Context, db *sql.DB, q string, args ...any) ([]*storage.Page, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []*storage.Page
+
+	for rows.Next() {
+		p, err := scanPage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan page: %w", err)
+		}
+
+		res = append(res, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// tsQuery builds a tsquery matching pages that contain words starting
+// with every term of query. It returns an empty string if query has no terms.
+func tsQuery(query string) string {
+	terms := storage.SearchTerms(query)
+
+	for i, t := range terms {
+		terms[i] = t + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// where accumulates the conditions and arguments of a WHERE clause.
+type where struct {
+	conds []string // Conditions joined with AND
+	args  []any    // Query arguments in placeholder order
+}
+
+// newWhere selects the pages of userID that match f.
+func newWhere(userID int64, f storage.Filter) *where {
+	w := &where{}
+
+	w.conds = append(w.conds, "user_id = "+w.bind(userID))
+
+	switch f.State {
+	case storage.StateUnread:
+		w.conds = append(w.conds, "read_at IS NULL")
+	case storage.StateRead:
+		w.conds = append(w.conds, "read_at IS NOT NULL")
+	}
+
+	if f.Tag != "" {
+		w.conds = append(w.conds, `id IN (SELECT page_id FROM page_tags
+			JOIN tags ON tags.id = page_tags.tag_id WHERE tags.name = `+w.bind(f.Tag)+`)`)
+	}
+
+	return w
+}
+
+// bind adds an argument and returns its placeholder.
+func (w *where) bind(v any) string {
+	w.args = append(w.args, v)
+
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+// String returns the conditions joined with AND.
+func (w *where) String() string {
+	return strings.Join(w.conds, " AND ")
+}
+
+// scanDeadLetter reads a row selected with deadLetterColumns into a DeadLetter.
+func scanDeadLetter(row interface{ Scan(dest ...any) error }) (*storage.DeadLetter, error) {
+	var (
+		d             storage.DeadLetter
+		id            int64
+		nextAttemptAt sql.NullTime
+	)
+
+	if err := row.Scan(&id, &d.Payload, &d.Error, &d.Attempts, &d.FailedAt, &nextAttemptAt); err != nil {
+		return nil, err
+	}
+
+	d.ID = strconv.FormatInt(id, 10)
+	d.NextAttemptAt = nextAttemptAt.Time
+
+	return &d, nil
+}
+
+// checkPageAffected returns ErrPageNotFound if the statement changed no rows.
+func checkPageAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot check affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return storage.ErrPageNotFound
+	}
+
+	return nil
+}
+
+// checkDeadLetterAffected returns ErrDeadLetterNotFound if the statement changed no rows.
+func checkDeadLetterAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot check affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return storage.ErrDeadLetterNotFound
+	}
+
+	return nil
+}
+
+// nullTime maps the zero time to SQL NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nonNil returns an empty slice instead of nil so it is encoded as a JSON array.
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+
+	return tags
+}
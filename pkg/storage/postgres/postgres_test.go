@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/storagetest"
+	"os"
+	"testing"
+)
+
+// dsnEnv names the variable holding the DSN of a disposable test database.
+const dsnEnv = "POSTGRES_TEST_DSN"
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, testConstructor(t))
+}
+
+func TestLegacyURLs(t *testing.T) {
+	storagetest.RunLegacyURLs(t, testConstructor(t), saveLegacy)
+}
+
+// testConstructor returns a constructor of storages backed by the emptied
+// test database. The test is skipped if no database is configured.
+func testConstructor(t *testing.T) storagetest.Constructor {
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", dsnEnv)
+	}
+
+	return func(t *testing.T) storage.Storage {
+		s, err := New(dsn)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+
+		ctx := context.Background()
+
+		if err := s.Init(ctx); err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+
+		if _, err := s.db.ExecContext(ctx, `TRUNCATE pages, tags, page_tags, offsets, dead_letters;`); err != nil {
+			t.Fatalf("truncate tables: %v", err)
+		}
+
+		return s
+	}
+}
+
+// saveLegacy inserts pages with their raw URLs, as versions before URL
+// canonicalization did, and then runs the canonical_urls migration again.
+func saveLegacy(t *testing.T, st storage.Storage, pages ...*storage.Page) {
+	ctx := context.Background()
+	s := st.(*Storage)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, p := range pages {
+		tags, err := json.Marshal(nonNil(p.Tags))
+		if err != nil {
+			t.Fatalf("encode tags: %v", err)
+		}
+
+		var id int64
+
+		q := `INSERT INTO pages (url, user_id, user_name, tags) VALUES ($1, $2, $3, $4) RETURNING id;`
+		if err := tx.QueryRowContext(ctx, q, p.URL, p.UserID, p.UserName, string(tags)).Scan(&id); err != nil {
+			t.Fatalf("insert legacy page: %v", err)
+		}
+
+		if err := linkTags(ctx, tx, id, p.Tags); err != nil {
+			t.Fatalf("linkTags: %v", err)
+		}
+	}
+
+	if err := canonicalizeURLs(ctx, tx); err != nil {
+		t.Fatalf("canonicalizeURLs: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
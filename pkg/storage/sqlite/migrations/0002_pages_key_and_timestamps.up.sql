@@ -0,0 +1,18 @@
+-- SQLite cannot add constraints to an existing table, so it is rebuilt.
+-- Rows with missing values and duplicates left by older versions are dropped.
+CREATE TABLE pages_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url        TEXT      NOT NULL,
+    user_name  TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_name, url)
+);
+
+INSERT OR IGNORE INTO pages_new (url, user_name)
+SELECT url, user_name FROM pages
+WHERE url IS NOT NULL AND user_name IS NOT NULL
+ORDER BY rowid;
+
+DROP TABLE pages;
+
+ALTER TABLE pages_new RENAME TO pages;
@@ -0,0 +1,5 @@
+ALTER TABLE pages ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE pages ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE pages ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE pages ADD COLUMN note TEXT NOT NULL DEFAULT '';
+ALTER TABLE pages ADD COLUMN read_at TIMESTAMP;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS offsets (
+    name TEXT PRIMARY KEY,
+    value INTEGER NOT NULL
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    payload         BLOB      NOT NULL,
+    error           TEXT      NOT NULL DEFAULT '',
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    failed_at       TIMESTAMP NOT NULL,
+    next_attempt_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_next_attempt_at_idx ON dead_letters (next_attempt_at);
@@ -0,0 +1,2 @@
+ALTER TABLE pages ADD COLUMN source_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE pages ADD COLUMN source_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,30 @@
+-- Pages are keyed by the Telegram user ID instead of the username.
+-- SQLite cannot change constraints of an existing table, so it is rebuilt.
+-- Rows saved by older versions keep a NULL user_id until MigrateUser
+-- assigns them to the user who owns the username.
+CREATE TABLE pages_new (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    url         TEXT      NOT NULL,
+    user_id     INTEGER,
+    user_name   TEXT      NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title       TEXT      NOT NULL DEFAULT '',
+    description TEXT      NOT NULL DEFAULT '',
+    tags        TEXT      NOT NULL DEFAULT '[]',
+    note        TEXT      NOT NULL DEFAULT '',
+    read_at     TIMESTAMP,
+    source_name TEXT      NOT NULL DEFAULT '',
+    source_url  TEXT      NOT NULL DEFAULT '',
+    UNIQUE (user_id, url)
+);
+
+INSERT INTO pages_new (id, url, user_name, created_at, title, description, tags, note, read_at, source_name, source_url)
+SELECT id, url, user_name, created_at, title, description, tags, note, read_at, source_name, source_url
+FROM pages
+ORDER BY id;
+
+DROP TABLE pages;
+
+ALTER TABLE pages_new RENAME TO pages;
+
+CREATE INDEX pages_legacy_user_name_idx ON pages (user_name) WHERE user_id IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE pages ADD COLUMN site_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE pages ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,28 @@
+-- Full-text index of the searchable page fields. It is an external content
+-- table over pages, kept in sync by the triggers below.
+CREATE VIRTUAL TABLE pages_fts USING fts5(
+    url, title, description, tags, note,
+    content = 'pages',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO pages_fts (rowid, url, title, description, tags, note)
+SELECT id, url, title, description, tags, note FROM pages;
+
+CREATE TRIGGER pages_fts_insert AFTER INSERT ON pages BEGIN
+    INSERT INTO pages_fts (rowid, url, title, description, tags, note)
+    VALUES (new.id, new.url, new.title, new.description, new.tags, new.note);
+END;
+
+CREATE TRIGGER pages_fts_delete AFTER DELETE ON pages BEGIN
+    INSERT INTO pages_fts (pages_fts, rowid, url, title, description, tags, note)
+    VALUES ('delete', old.id, old.url, old.title, old.description, old.tags, old.note);
+END;
+
+CREATE TRIGGER pages_fts_update AFTER UPDATE OF url, title, description, tags, note ON pages BEGIN
+    INSERT INTO pages_fts (pages_fts, rowid, url, title, description, tags, note)
+    VALUES ('delete', old.id, old.url, old.title, old.description, old.tags, old.note);
+    INSERT INTO pages_fts (rowid, url, title, description, tags, note)
+    VALUES (new.id, new.url, new.title, new.description, new.tags, new.note);
+END;
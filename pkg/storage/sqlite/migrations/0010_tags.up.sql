@@ -0,0 +1,27 @@
+-- Tags of pages, shared by every user. page_tags is the source of truth for
+-- filtering and counting; pages.tags keeps a JSON copy of the page's tag
+-- names for the full-text index.
+CREATE TABLE tags (
+    id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT    NOT NULL UNIQUE
+);
+
+CREATE TABLE page_tags (
+    page_id INTEGER NOT NULL REFERENCES pages (id) ON DELETE CASCADE,
+    tag_id  INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (page_id, tag_id)
+);
+
+CREATE INDEX page_tags_tag_id_idx ON page_tags (tag_id);
+
+INSERT INTO tags (name)
+SELECT DISTINCT t.value FROM pages JOIN json_each(pages.tags) AS t
+WHERE t.value <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO page_tags (page_id, tag_id)
+SELECT DISTINCT pages.id, tags.id FROM pages
+JOIN json_each(pages.tags) AS t
+JOIN tags ON tags.name = t.value
+WHERE t.value <> ''
+ON CONFLICT (page_id, tag_id) DO NOTHING;
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_link_storage/pkg/storage"
+	"go_link_storage/pkg/storage/storagetest"
+	"strings"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newTestStorage(t)
+	})
+}
+
+func TestMigrateUser(t *testing.T) {
+	const userID = 42
+
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	// Rows saved by older versions have no user ID.
+	q := `INSERT INTO pages (url, user_name) VALUES
+		('https://example.com/a', 'alice'),
+		('https://example.com/b', 'alice'),
+		('https://example.com/a', 'bob');`
+
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		t.Fatalf("insert legacy pages: %v", err)
+	}
+
+	if err := s.Save(ctx, &storage.Page{URL: "https://example.com/a", UserID: userID, UserName: "alice"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if err := s.MigrateUser(ctx, "alice", userID); err != nil {
+		t.Fatalf("MigrateUser: %v", err)
+	}
+
+	pages, err := s.List(ctx, userID, storage.Filter{}, 0, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(pages) != 2 {
+		t.Fatalf("List returned %d pages, want 2", len(pages))
+	}
+
+	var legacy int
+
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pages WHERE user_id IS NULL;`).Scan(&legacy); err != nil {
+		t.Fatalf("count legacy pages: %v", err)
+	}
+
+	if legacy != 1 {
+		t.Fatalf("%d legacy pages left, want only the one of bob", legacy)
+	}
+}
+
+func TestLegacyURLs(t *testing.T) {
+	storagetest.RunLegacyURLs(t, func(t *testing.T) storage.Storage {
+		return newTestStorage(t)
+	}, saveLegacy)
+}
+
+// saveLegacy inserts pages with their raw URLs, as versions before URL
+// canonicalization did, and then runs the canonical_urls migration again.
+func saveLegacy(t *testing.T, st storage.Storage, pages ...*storage.Page) {
+	ctx := context.Background()
+	s := st.(*Storage)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, p := range pages {
+		tags, err := json.Marshal(nonNil(p.Tags))
+		if err != nil {
+			t.Fatalf("encode tags: %v", err)
+		}
+
+		var id int64
+
+		q := `INSERT INTO pages (url, user_id, user_name, tags) VALUES (?, ?, ?, ?) RETURNING id;`
+		if err := tx.QueryRowContext(ctx, q, p.URL, p.UserID, p.UserName, string(tags)).Scan(&id); err != nil {
+			t.Fatalf("insert legacy page: %v", err)
+		}
+
+		if err := linkTags(ctx, tx, id, p.Tags); err != nil {
+			t.Fatalf("linkTags: %v", err)
+		}
+	}
+
+	if err := canonicalizeURLs(ctx, tx); err != nil {
+		t.Fatalf("canonicalizeURLs: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+// newTestStorage opens an initialized storage backed by an in-memory database.
+func newTestStorage(t *testing.T) *Storage {
+	// Every test gets its own named in-memory database shared by the pool.
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+
+	s, err := New(fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	return s
+}
@@ -8,44 +8,202 @@ import (
 	"errors"
 	"fmt"
 	"go_link_storage/pkg/lib/e"
+	"go_link_storage/pkg/urlnorm"
 	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 )
 
 // Storage defines the interface for page storage operations.
 // Implementations should provide persistent storage for pages associated with users.
+// Users are identified by their numeric Telegram ID.
 type Storage interface {
-	// Save stores a page in the storage.
+	// Save stores a page in the storage. The URL is canonicalized with urlnorm
+	// first, and Save, Exists and Remove compare pages by canonical URL.
+	// Tags are stored as returned by NormalizeTags.
 	Save(ctx context.Context, p *Page) error
-	// PickRandom retrieves a random page for the given user.
-	PickRandom(ctx context.Context, userName string) (*Page, error)
-	// Remove deletes a page from the storage.
+	// PickRandom retrieves a random page for the given user among the pages matching f.
+	PickRandom(ctx context.Context, userID int64, f Filter) (*Page, error)
+	// Remove deletes a page from the storage. Removing a page that is not
+	// saved is a no-op.
 	Remove(ctx context.Context, p *Page) error
 	// Exists checks if a page already exists in the storage.
 	Exists(ctx context.Context, p *Page) (bool, error)
+	// List returns up to limit pages of the given user matching f, newest first,
+	// skipping the first offset pages.
+	List(ctx context.Context, userID int64, f Filter, offset, limit int) ([]*Page, error)
+	// Search returns up to limit pages of the given user that match every term
+	// of query, best matches first, skipping the first offset pages. Terms are
+	// found by SearchTerms and match words starting with them in the URL, title,
+	// description, tags and note.
+	Search(ctx context.Context, userID int64, query string, offset, limit int) ([]*Page, error)
+	// SetReadAt updates the read time of the page identified by p.ID and p.UserID.
+	// A zero readAt returns the page to the unread pool.
+	SetReadAt(ctx context.Context, p *Page, readAt time.Time) error
+	// MigrateUser moves the pages older versions saved under userName to userID.
+	// Pages the user has already saved under userID win over the legacy copies.
+	// It is a no-op once there is nothing left to move.
+	MigrateUser(ctx context.Context, userName string, userID int64) error
+	// SetPreview updates Title, Description, SiteName and ImageURL of the page
+	// identified by p.ID and p.UserID.
+	SetPreview(ctx context.Context, p *Page) error
+	// AddTags adds tags to the page identified by p.ID and p.UserID, keeping
+	// the tags it already has. Tags are normalized with NormalizeTags.
+	AddTags(ctx context.Context, p *Page, tags []string) error
+	// Tags returns the tags of the given user's pages with the number of pages
+	// carrying each, most used first and then by name.
+	Tags(ctx context.Context, userID int64) ([]TagCount, error)
 }
 
-// ErrNoSavedPages is returned when attempting to pick a random page
-// but no pages are saved for the user.
-var ErrNoSavedPages = errors.New("no saved pages")
+// OffsetStore persists the positions of update streams, so that consumers
+// resume where they stopped after a restart.
+type OffsetStore interface {
+	// Offset returns the stored offset of the named stream, or 0 if none is stored.
+	Offset(ctx context.Context, name string) (int, error)
+	// SetOffset stores the offset of the named stream, replacing the previous one.
+	SetOffset(ctx context.Context, name string, offset int) error
+}
+
+// DeadLetterStore keeps events that failed processing until they are retried or purged.
+type DeadLetterStore interface {
+	// AddDeadLetter stores a new dead letter and writes the assigned ID back to d.
+	AddDeadLetter(ctx context.Context, d *DeadLetter) error
+	// UpdateDeadLetter saves Error, Attempts and NextAttemptAt of the dead letter identified by d.ID.
+	UpdateDeadLetter(ctx context.Context, d *DeadLetter) error
+	// RemoveDeadLetter deletes the dead letter with the given ID.
+	RemoveDeadLetter(ctx context.Context, id string) error
+	// DeadLetter returns the dead letter with the given ID.
+	DeadLetter(ctx context.Context, id string) (*DeadLetter, error)
+	// DeadLetters returns up to limit dead letters. A zero due returns every
+	// dead letter, oldest first; otherwise only those whose next attempt is
+	// due by then are returned, most overdue first.
+	DeadLetters(ctx context.Context, due time.Time, limit int) ([]*DeadLetter, error)
+}
+
+var (
+	// ErrNoSavedPages is returned when attempting to pick a random page
+	// but no pages are saved for the user.
+	ErrNoSavedPages = errors.New("no saved pages")
+	// ErrPageNotFound is returned when the page to update does not exist.
+	ErrPageNotFound = errors.New("page not found")
+	// ErrDeadLetterNotFound is returned when the dead letter to update or remove does not exist.
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// State selects pages by whether they have been read.
+type State int
+
+const (
+	StateAny    State = iota // Both read and unread pages
+	StateUnread              // Pages that have not been read yet
+	StateRead                // Archived pages that have been read
+)
+
+// Filter narrows down the pages returned by PickRandom and List.
+// The zero Filter matches every page.
+type Filter struct {
+	State State  // Read state of the pages
+	Tag   string // Tag the pages carry, as returned by NormalizeTag; empty for any
+}
+
+// Match reports whether the page passes the filter.
+func (f Filter) Match(p *Page) bool {
+	if f.Tag != "" && !slices.Contains(p.Tags, f.Tag) {
+		return false
+	}
+
+	switch f.State {
+	case StateUnread:
+		return p.ReadAt.IsZero()
+	case StateRead:
+		return !p.ReadAt.IsZero()
+	default:
+		return true
+	}
+}
 
-// Page represents a saved web page with its URL and associated username.
+// Page represents a saved web page with its URL and the user who saved it.
+// Fields other than URL and UserID are optional and may be empty.
 type Page struct {
 	URL      string // The URL of the page
-	UserName string // The username of the user who saved the page
+	UserID   int64  // Telegram ID of the user who saved the page
+	UserName string // Telegram username of the user at the time the page was saved
+
+	ID          string    // Backend-specific identifier, assigned by the storage
+	SavedAt     time.Time // When the page was saved, set by the storage if zero
+	Title       string    // Page title
+	Description string    // Short description of the page content
+	SiteName    string    // Name of the site the page belongs to
+	ImageURL    string    // Preview image of the page
+	Tags        []string  // User-defined tags
+	Note        string    // Free-form user note
+	ReadAt      time.Time // When the page was read, zero if it is unread
+	SourceName  string    // Channel or chat the link was forwarded from
+	SourceURL   string    // Link to the message the link was forwarded from
 }
 
-// Hash calculates a SHA1 hash of the page based on its URL and username.
+// Hash calculates a SHA1 hash of the page based on its canonical URL and user ID.
 // This hash is used as a unique identifier for the page in storage.
 func (p Page) Hash() (string, error) {
 	h := sha1.New()
 
-	if _, err := io.WriteString(h, p.URL); err != nil {
+	if _, err := io.WriteString(h, urlnorm.Normalize(p.URL)); err != nil {
 		return "", e.Wrap("cannot calculate hash", err)
 	}
 
-	if _, err := io.WriteString(h, p.UserName); err != nil {
+	if _, err := io.WriteString(h, strconv.FormatInt(p.UserID, 10)); err != nil {
 		return "", e.Wrap("cannot calculate hash", err)
 	}
 
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
+
+// SearchTerms splits a search query into lowercase terms: runs of letters and digits.
+// Backends index page text split the same way, so punctuation in URLs and
+// queries never has to match exactly.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// TagCount is a tag with the number of pages carrying it.
+type TagCount struct {
+	Name  string // Tag name, as returned by NormalizeTag
+	Pages int    // Number of pages with the tag
+}
+
+// NormalizeTag returns the stored form of a tag: lowercase, without
+// surrounding spaces and the leading hash signs.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+}
+
+// NormalizeTags normalizes tags with NormalizeTag and returns them sorted,
+// without duplicates and empty tags.
+func NormalizeTags(tags []string) []string {
+	var res []string
+
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); tag != "" {
+			res = append(res, tag)
+		}
+	}
+
+	slices.Sort(res)
+
+	return slices.Compact(res)
+}
+
+// DeadLetter is an event that failed processing, kept to be retried later.
+type DeadLetter struct {
+	ID            string    // Backend-specific identifier, assigned by the storage
+	Payload       []byte    // Encoded event
+	Error         string    // Error of the last failed attempt
+	Attempts      int       // Number of failed attempts
+	FailedAt      time.Time // When the event failed for the first time
+	NextAttemptAt time.Time // When the event is retried next, zero if it is only replayed manually
+}
@@ -0,0 +1,970 @@
+// Package storagetest provides a behavioral test suite shared by all
+// storage.Storage implementations, so every backend is held to the same contract.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_link_storage/pkg/storage"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Constructor creates an empty storage for a single test.
+// It should register any cleanup with t.Cleanup.
+type Constructor func(t *testing.T) storage.Storage
+
+// pickAttempts is how many times PickRandom is called when checking that
+// every saved page can be picked.
+const pickAttempts = 200
+
+// Users the suite saves pages for.
+const (
+	alice int64 = 1001
+	bob   int64 = 1002
+)
+
+// LegacySaver stores pages with their URLs exactly as given, the way versions
+// before URL canonicalization did, and then runs the backend's upgrade of
+// stored URLs to their canonical form.
+type LegacySaver func(t *testing.T, s storage.Storage, pages ...*storage.Page)
+
+// Run runs the whole suite against the storage returned by newStorage.
+// Every subtest gets a fresh storage.
+func Run(t *testing.T, newStorage Constructor) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"SaveAndExists", testSaveAndExists},
+		{"RoundTrip", testRoundTrip},
+		{"DuplicateSave", testDuplicateSave},
+		{"CanonicalURL", testCanonicalURL},
+		{"PickRandomDistribution", testPickRandomDistribution},
+		{"Remove", testRemove},
+		{"UserIsolation", testUserIsolation},
+		{"List", testList},
+		{"Search", testSearch},
+		{"Tags", testTags},
+		{"ReadState", testReadState},
+		{"Preview", testPreview},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"NoSavedPages", testNoSavedPages},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+
+	t.Run("Offsets", func(t *testing.T) {
+		offsets, ok := newStorage(t).(storage.OffsetStore)
+		if !ok {
+			t.Skip("storage does not implement storage.OffsetStore")
+		}
+
+		testOffsets(t, offsets)
+	})
+
+	t.Run("DeadLetters", func(t *testing.T) {
+		deadLetters, ok := newStorage(t).(storage.DeadLetterStore)
+		if !ok {
+			t.Skip("storage does not implement storage.DeadLetterStore")
+		}
+
+		testDeadLetters(t, deadLetters)
+	})
+}
+
+// RunLegacyURLs checks that pages stored with URLs that are not canonical
+// are found, merged and removed by their canonical URL once saveLegacy has
+// upgraded them. newStorage must return a storage the upgrade has not run on.
+func RunLegacyURLs(t *testing.T, newStorage Constructor, saveLegacy LegacySaver) {
+	ctx := context.Background()
+	s := newStorage(t)
+
+	first := page("https://Example.com/a?utm_source=x#frag", alice)
+	first.Tags = []string{"go"}
+
+	second := page("https://example.com:443/a", alice)
+	second.Tags = []string{"perf"}
+
+	saveLegacy(t, s, first, second,
+		page("https://example.com/b", alice),
+		page("https://EXAMPLE.com/a", bob),
+	)
+
+	const canonical = "https://example.com/a"
+
+	assertExists(t, s, page(canonical, alice), true)
+	assertExists(t, s, page(canonical, bob), true)
+
+	pages, err := s.List(ctx, alice, storage.Filter{}, 0, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	var merged *storage.Page
+	for _, p := range pages {
+		if p.URL == canonical {
+			merged = p
+		}
+	}
+
+	if len(pages) != 2 || merged == nil {
+		t.Fatalf("List = %+v, want the duplicates merged into %q and one more page", pages, canonical)
+	}
+
+	if want := []string{"go", "perf"}; !slices.Equal(merged.Tags, want) {
+		t.Errorf("merged page has tags %q, want %q", merged.Tags, want)
+	}
+
+	tags, err := s.Tags(ctx, alice)
+	if err != nil {
+		t.Fatalf("Tags: %v", err)
+	}
+
+	if want := []storage.TagCount{{Name: "go", Pages: 1}, {Name: "perf", Pages: 1}}; !slices.Equal(tags, want) {
+		t.Errorf("Tags = %v, want %v", tags, want)
+	}
+
+	if err := s.Remove(ctx, page(canonical, alice)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	assertExists(t, s, page(canonical, alice), false)
+	assertExists(t, s, page(canonical, bob), true)
+	assertExists(t, s, page("https://example.com/b", alice), true)
+}
+
+func testSaveAndExists(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p := page("https://example.com/a", alice)
+
+	assertExists(t, s, p, false)
+
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	assertExists(t, s, p, true)
+	assertExists(t, s, page("https://example.com/b", alice), false)
+}
+
+func testRoundTrip(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	savedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	want := &storage.Page{
+		URL:         "https://example.com/a",
+		UserID:      alice,
+		UserName:    "alice",
+		SavedAt:     savedAt,
+		Title:       "Example",
+		Description: "An example page",
+		Tags:        []string{"go", "perf"},
+		Note:        "read later",
+		ReadAt:      savedAt.Add(time.Hour),
+		SourceName:  "Go News",
+		SourceURL:   "https://t.me/gonews/42",
+		SiteName:    "Example Site",
+		ImageURL:    "https://example.com/a.png",
+	}
+
+	if err := s.Save(ctx, want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if want.ID == "" {
+		t.Fatal("Save did not assign an ID")
+	}
+
+	got, err := s.PickRandom(ctx, alice, storage.Filter{})
+	if err != nil {
+		t.Fatalf("PickRandom: %v", err)
+	}
+
+	if got.ID != want.ID || got.URL != want.URL || got.UserID != want.UserID || got.UserName != want.UserName ||
+		got.Title != want.Title || got.Description != want.Description || got.Note != want.Note ||
+		!slices.Equal(got.Tags, want.Tags) || !got.SavedAt.Equal(want.SavedAt) || !got.ReadAt.Equal(want.ReadAt) ||
+		got.SourceName != want.SourceName || got.SourceURL != want.SourceURL ||
+		got.SiteName != want.SiteName || got.ImageURL != want.ImageURL {
+		t.Fatalf("PickRandom = %+v, want %+v", got, want)
+	}
+
+	p := page("https://example.com/b", bob)
+
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if p.SavedAt.IsZero() {
+		t.Fatal("Save did not set SavedAt")
+	}
+
+	got, err = s.PickRandom(ctx, bob, storage.Filter{})
+	if err != nil {
+		t.Fatalf("PickRandom: %v", err)
+	}
+
+	if !got.ReadAt.IsZero() || len(got.Tags) != 0 {
+		t.Fatalf("PickRandom = %+v, want unread page without tags", got)
+	}
+}
+
+func testDuplicateSave(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p := page("https://example.com/a", alice)
+
+	for i := 0; i < 2; i++ {
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save #%d: %v", i+1, err)
+		}
+	}
+
+	assertExists(t, s, p, true)
+
+	if err := s.Remove(ctx, p); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	assertExists(t, s, p, false)
+}
+
+func testCanonicalURL(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	p := page("https://Example.com/a?utm_source=x&b=2&a=1#frag", alice)
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	const canonical = "https://example.com/a?a=1&b=2"
+
+	if p.URL != canonical {
+		t.Fatalf("Save wrote back URL %q, want %q", p.URL, canonical)
+	}
+
+	assertExists(t, s, page(canonical, alice), true)
+	assertExists(t, s, page("https://example.com:443/a?b=2&a=1&fbclid=1", alice), true)
+
+	if err := s.Save(ctx, page("https://EXAMPLE.com/a?a=1&b=2#other", alice)); err != nil {
+		t.Fatalf("Save variant: %v", err)
+	}
+
+	pages, err := s.List(ctx, alice, storage.Filter{}, 0, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(pages) != 1 || pages[0].URL != canonical {
+		t.Fatalf("List = %+v, want one page with URL %q", pages, canonical)
+	}
+
+	if err := s.Remove(ctx, page("https://example.com/a?b=2&a=1#frag", alice)); err != nil {
+		t.Fatalf("Remove variant: %v", err)
+	}
+
+	assertExists(t, s, page(canonical, alice), false)
+}
+
+func testPickRandomDistribution(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+
+	for _, u := range urls {
+		if err := s.Save(ctx, page(u, alice)); err != nil {
+			t.Fatalf("Save %s: %v", u, err)
+		}
+	}
+
+	seen := make(map[string]int, len(urls))
+
+	for i := 0; i < pickAttempts; i++ {
+		p, err := s.PickRandom(ctx, alice, storage.Filter{})
+		if err != nil {
+			t.Fatalf("PickRandom: %v", err)
+		}
+
+		if p.UserID != alice {
+			t.Fatalf("PickRandom returned page of %d, want %d", p.UserID, alice)
+		}
+
+		seen[p.URL]++
+	}
+
+	for _, u := range urls {
+		if seen[u] == 0 {
+			t.Errorf("%s was never picked in %d attempts: %v", u, pickAttempts, seen)
+		}
+	}
+
+	if len(seen) != len(urls) {
+		t.Errorf("picked unexpected pages: %v", seen)
+	}
+}
+
+func testRemove(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	a := page("https://example.com/a", alice)
+	b := page("https://example.com/b", alice)
+
+	for _, p := range []*storage.Page{a, b} {
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	if err := s.Remove(ctx, a); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	assertExists(t, s, a, false)
+	assertExists(t, s, b, true)
+
+	// Removing a page twice, or one that was never saved, is not an error.
+	for _, p := range []*storage.Page{a, page("https://example.com/never-saved", alice), page(b.URL, bob)} {
+		if err := s.Remove(ctx, p); err != nil {
+			t.Fatalf("Remove of missing page %s: %v", p.URL, err)
+		}
+	}
+
+	assertExists(t, s, b, true)
+
+	for i := 0; i < pickAttempts; i++ {
+		p, err := s.PickRandom(ctx, alice, storage.Filter{})
+		if err != nil {
+			t.Fatalf("PickRandom: %v", err)
+		}
+
+		if p.URL != b.URL {
+			t.Fatalf("PickRandom returned removed page %s", p.URL)
+		}
+	}
+}
+
+func testUserIsolation(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	p := page("https://example.com/a", alice)
+
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	assertExists(t, s, page(p.URL, bob), false)
+
+	if _, err := s.PickRandom(ctx, bob, storage.Filter{}); !errors.Is(err, storage.ErrNoSavedPages) {
+		t.Fatalf("PickRandom for another user: got %v, want %v", err, storage.ErrNoSavedPages)
+	}
+
+	if err := s.Save(ctx, page(p.URL, bob)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if err := s.Remove(ctx, page(p.URL, bob)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	assertExists(t, s, p, true)
+}
+
+func testList(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+
+	for i, u := range urls {
+		p := page(u, alice)
+		p.SavedAt = base.Add(time.Duration(i) * time.Hour)
+
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save %s: %v", u, err)
+		}
+	}
+
+	tests := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 2, []string{urls[2], urls[1]}},
+		{2, 2, []string{urls[0]}},
+		{0, 10, []string{urls[2], urls[1], urls[0]}},
+		{3, 2, nil},
+	}
+
+	for _, tt := range tests {
+		pages, err := s.List(ctx, alice, storage.Filter{}, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("List(%d, %d): %v", tt.offset, tt.limit, err)
+		}
+
+		var got []string
+		for _, p := range pages {
+			got = append(got, p.URL)
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("List(%d, %d) = %v, want %v", tt.offset, tt.limit, got, tt.want)
+		}
+	}
+
+	pages, err := s.List(ctx, bob, storage.Filter{}, 0, 10)
+	if err != nil {
+		t.Fatalf("List for another user: %v", err)
+	}
+
+	if len(pages) != 0 {
+		t.Fatalf("List for another user returned %d pages", len(pages))
+	}
+}
+
+func testSearch(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	pages := []*storage.Page{
+		{URL: "https://example.com/golang-tips", Title: "Effective tips"},
+		{URL: "https://example.com/a", Title: "Golang generics", Description: "Type parameters explained"},
+		{URL: "https://example.com/b", Tags: []string{"databases", "golang"}},
+		{URL: "https://example.com/c", Note: "Read about Postgres indexes"},
+		{URL: "https://example.com/d", Title: "Rust ownership"},
+	}
+
+	for i, p := range pages {
+		p.UserID = alice
+		p.SavedAt = base.Add(time.Duration(i) * time.Hour)
+
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save %s: %v", p.URL, err)
+		}
+	}
+
+	other := &storage.Page{URL: "https://example.com/e", UserID: bob, Title: "Golang for Bob"}
+	if err := s.Save(ctx, other); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	search := func(query string, offset, limit int) []string {
+		t.Helper()
+
+		res, err := s.Search(ctx, alice, query, offset, limit)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", query, err)
+		}
+
+		var got []string
+		for _, p := range res {
+			got = append(got, p.URL)
+		}
+
+		return got
+	}
+
+	tests := []struct {
+		query         string
+		offset, limit int
+		want          []string
+	}{
+		{"golang", 0, 10, []string{pages[1].URL, pages[2].URL, pages[0].URL}},
+		{"GoLang", 0, 1, []string{pages[1].URL}},
+		{"golang", 1, 10, []string{pages[2].URL, pages[0].URL}},
+		{"golang", 3, 10, nil},
+		{"gen", 0, 10, []string{pages[1].URL}},
+		{"golang generics", 0, 10, []string{pages[1].URL}},
+		{"golang rust", 0, 10, nil},
+		{"postgres", 0, 10, []string{pages[3].URL}},
+		{"type-parameters", 0, 10, []string{pages[1].URL}},
+		{"bob", 0, 10, nil},
+		{"", 0, 10, nil},
+		{"!?", 0, 10, nil},
+	}
+
+	for _, tt := range tests {
+		if got := search(tt.query, tt.offset, tt.limit); !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q, %d, %d) = %v, want %v", tt.query, tt.offset, tt.limit, got, tt.want)
+		}
+	}
+
+	preview := &storage.Page{ID: pages[4].ID, UserID: alice, Title: "Rust and Golang"}
+	if err := s.SetPreview(ctx, preview); err != nil {
+		t.Fatalf("SetPreview: %v", err)
+	}
+
+	if err := s.Remove(ctx, pages[1]); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	want := []string{pages[4].URL, pages[2].URL, pages[0].URL}
+	if got := search("golang", 0, 10); !slices.Equal(got, want) {
+		t.Errorf("Search after changes = %v, want %v", got, want)
+	}
+}
+
+func testTags(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	a := page("https://example.com/a", alice)
+	a.Tags = []string{"Go", "#perf", "go", " "}
+
+	b := page("https://example.com/b", alice)
+	b.Tags = []string{"go"}
+
+	c := page("https://example.com/c", alice)
+	other := page("https://example.com/a", bob)
+	other.Tags = []string{"rust"}
+
+	for _, p := range []*storage.Page{a, b, c, other} {
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save %s: %v", p.URL, err)
+		}
+	}
+
+	if want := []string{"go", "perf"}; !slices.Equal(a.Tags, want) {
+		t.Fatalf("Save wrote back tags %q, want %q", a.Tags, want)
+	}
+
+	tagged := &storage.Page{ID: c.ID, UserID: alice}
+	if err := s.AddTags(ctx, tagged, []string{"PERF", "db"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+
+	if err := s.AddTags(ctx, tagged, []string{"go"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+
+	if want := []string{"db", "go", "perf"}; !slices.Equal(tagged.Tags, want) {
+		t.Fatalf("AddTags wrote back tags %q, want %q", tagged.Tags, want)
+	}
+
+	counts, err := s.Tags(ctx, alice)
+	if err != nil {
+		t.Fatalf("Tags: %v", err)
+	}
+
+	want := []storage.TagCount{{Name: "go", Pages: 3}, {Name: "perf", Pages: 2}, {Name: "db", Pages: 1}}
+	if !slices.Equal(counts, want) {
+		t.Fatalf("Tags = %v, want %v", counts, want)
+	}
+
+	for i := 0; i < pickAttempts; i++ {
+		p, err := s.PickRandom(ctx, alice, storage.Filter{Tag: "db"})
+		if err != nil {
+			t.Fatalf("PickRandom by tag: %v", err)
+		}
+
+		if p.URL != c.URL {
+			t.Fatalf("PickRandom by tag returned %s, want %s", p.URL, c.URL)
+		}
+	}
+
+	if _, err := s.PickRandom(ctx, alice, storage.Filter{Tag: "rust"}); !errors.Is(err, storage.ErrNoSavedPages) {
+		t.Fatalf("PickRandom by another user's tag: got %v, want %v", err, storage.ErrNoSavedPages)
+	}
+
+	pages, err := s.List(ctx, alice, storage.Filter{Tag: "perf"}, 0, 10)
+	if err != nil {
+		t.Fatalf("List by tag: %v", err)
+	}
+
+	var urls []string
+	for _, p := range pages {
+		urls = append(urls, p.URL)
+	}
+
+	slices.Sort(urls)
+
+	if want := []string{a.URL, c.URL}; !slices.Equal(urls, want) {
+		t.Fatalf("List by tag = %v, want %v", urls, want)
+	}
+
+	if err := s.AddTags(ctx, &storage.Page{ID: c.ID, UserID: bob}, []string{"x"}); !errors.Is(err, storage.ErrPageNotFound) {
+		t.Fatalf("AddTags for another user: got %v, want %v", err, storage.ErrPageNotFound)
+	}
+
+	if err := s.Remove(ctx, a); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	counts, err = s.Tags(ctx, alice)
+	if err != nil {
+		t.Fatalf("Tags: %v", err)
+	}
+
+	want = []storage.TagCount{{Name: "go", Pages: 2}, {Name: "db", Pages: 1}, {Name: "perf", Pages: 1}}
+	if !slices.Equal(counts, want) {
+		t.Fatalf("Tags after Remove = %v, want %v", counts, want)
+	}
+
+	counts, err = s.Tags(ctx, 9999)
+	if err != nil {
+		t.Fatalf("Tags for unknown user: %v", err)
+	}
+
+	if len(counts) != 0 {
+		t.Fatalf("Tags for unknown user = %v, want none", counts)
+	}
+}
+
+func testReadState(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	unread := storage.Filter{State: storage.StateUnread}
+	read := storage.Filter{State: storage.StateRead}
+
+	a := page("https://example.com/a", alice)
+	b := page("https://example.com/b", alice)
+
+	for _, p := range []*storage.Page{a, b} {
+		if err := s.Save(ctx, p); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	readAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if err := s.SetReadAt(ctx, &storage.Page{ID: a.ID, UserID: alice}, readAt); err != nil {
+		t.Fatalf("SetReadAt: %v", err)
+	}
+
+	for i := 0; i < pickAttempts; i++ {
+		p, err := s.PickRandom(ctx, alice, unread)
+		if err != nil {
+			t.Fatalf("PickRandom unread: %v", err)
+		}
+
+		if p.URL != b.URL {
+			t.Fatalf("PickRandom unread returned read page %s", p.URL)
+		}
+	}
+
+	archived, err := s.List(ctx, alice, read, 0, 10)
+	if err != nil {
+		t.Fatalf("List read: %v", err)
+	}
+
+	if len(archived) != 1 || archived[0].URL != a.URL || !archived[0].ReadAt.Equal(readAt) {
+		t.Fatalf("List read = %v, want only %s read at %s", archived, a.URL, readAt)
+	}
+
+	if err := s.SetReadAt(ctx, &storage.Page{ID: b.ID, UserID: alice}, readAt); err != nil {
+		t.Fatalf("SetReadAt: %v", err)
+	}
+
+	if _, err := s.PickRandom(ctx, alice, unread); !errors.Is(err, storage.ErrNoSavedPages) {
+		t.Fatalf("PickRandom with every page read: got %v, want %v", err, storage.ErrNoSavedPages)
+	}
+
+	if err := s.SetReadAt(ctx, &storage.Page{ID: a.ID, UserID: alice}, time.Time{}); err != nil {
+		t.Fatalf("SetReadAt zero: %v", err)
+	}
+
+	p, err := s.PickRandom(ctx, alice, unread)
+	if err != nil {
+		t.Fatalf("PickRandom after putting a page back: %v", err)
+	}
+
+	if p.URL != a.URL {
+		t.Fatalf("PickRandom unread = %s, want %s", p.URL, a.URL)
+	}
+
+	if err := s.SetReadAt(ctx, &storage.Page{ID: a.ID, UserID: bob}, readAt); !errors.Is(err, storage.ErrPageNotFound) {
+		t.Fatalf("SetReadAt for another user: got %v, want %v", err, storage.ErrPageNotFound)
+	}
+
+	if err := s.SetReadAt(ctx, &storage.Page{ID: "999999", UserID: alice}, readAt); !errors.Is(err, storage.ErrPageNotFound) {
+		t.Fatalf("SetReadAt for unknown page: got %v, want %v", err, storage.ErrPageNotFound)
+	}
+}
+
+func testPreview(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	p := page("https://example.com/a", alice)
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	readAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	if err := s.SetReadAt(ctx, p, readAt); err != nil {
+		t.Fatalf("SetReadAt: %v", err)
+	}
+
+	preview := &storage.Page{
+		ID:          p.ID,
+		UserID:      alice,
+		Title:       "Example",
+		Description: "An example page",
+		SiteName:    "Example Site",
+		ImageURL:    "https://example.com/a.png",
+	}
+
+	if err := s.SetPreview(ctx, preview); err != nil {
+		t.Fatalf("SetPreview: %v", err)
+	}
+
+	got, err := s.PickRandom(ctx, alice, storage.Filter{})
+	if err != nil {
+		t.Fatalf("PickRandom: %v", err)
+	}
+
+	if got.Title != preview.Title || got.Description != preview.Description ||
+		got.SiteName != preview.SiteName || got.ImageURL != preview.ImageURL {
+		t.Fatalf("PickRandom = %+v, want preview %+v", got, preview)
+	}
+
+	if got.URL != p.URL || !got.ReadAt.Equal(readAt) {
+		t.Fatalf("SetPreview changed other fields: %+v", got)
+	}
+
+	if err := s.SetPreview(ctx, &storage.Page{ID: p.ID, UserID: bob}); !errors.Is(err, storage.ErrPageNotFound) {
+		t.Fatalf("SetPreview for other user: got %v, want %v", err, storage.ErrPageNotFound)
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	p := page("https://example.com/a", alice)
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	const updates = 20
+
+	readAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	var (
+		wg   sync.WaitGroup
+		want []string
+	)
+
+	// Previews are fetched in the background while the user tags and reads the page,
+	// so no update may overwrite another.
+	for i := range updates {
+		tag := fmt.Sprintf("tag%02d", i)
+		want = append(want, tag)
+
+		wg.Go(func() {
+			if err := s.AddTags(ctx, &storage.Page{ID: p.ID, UserID: alice}, []string{tag}); err != nil {
+				t.Errorf("AddTags: %v", err)
+			}
+		})
+
+		wg.Go(func() {
+			if err := s.SetPreview(ctx, &storage.Page{ID: p.ID, UserID: alice, Title: "Example"}); err != nil {
+				t.Errorf("SetPreview: %v", err)
+			}
+		})
+	}
+
+	wg.Go(func() {
+		if err := s.SetReadAt(ctx, &storage.Page{ID: p.ID, UserID: alice}, readAt); err != nil {
+			t.Errorf("SetReadAt: %v", err)
+		}
+	})
+
+	wg.Wait()
+
+	got, err := s.PickRandom(ctx, alice, storage.Filter{})
+	if err != nil {
+		t.Fatalf("PickRandom: %v", err)
+	}
+
+	if !slices.Equal(got.Tags, want) {
+		t.Errorf("tags = %v, want %v", got.Tags, want)
+	}
+
+	if got.Title != "Example" || !got.ReadAt.Equal(readAt) {
+		t.Errorf("PickRandom = %+v, want title Example read at %s", got, readAt)
+	}
+}
+
+func testNoSavedPages(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.PickRandom(ctx, 9999, storage.Filter{}); !errors.Is(err, storage.ErrNoSavedPages) {
+		t.Fatalf("PickRandom for unknown user: got %v, want %v", err, storage.ErrNoSavedPages)
+	}
+
+	p := page("https://example.com/a", alice)
+
+	if err := s.Save(ctx, p); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if err := s.Remove(ctx, p); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	if _, err := s.PickRandom(ctx, alice, storage.Filter{}); !errors.Is(err, storage.ErrNoSavedPages) {
+		t.Fatalf("PickRandom after removing every page: got %v, want %v", err, storage.ErrNoSavedPages)
+	}
+}
+
+func testCanceledContext(t *testing.T, s storage.Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := page("https://example.com/a", alice)
+
+	if err := s.Save(ctx, p); !errors.Is(err, context.Canceled) {
+		t.Errorf("Save: got %v, want %v", err, context.Canceled)
+	}
+
+	if _, err := s.Exists(ctx, p); !errors.Is(err, context.Canceled) {
+		t.Errorf("Exists: got %v, want %v", err, context.Canceled)
+	}
+
+	if _, err := s.PickRandom(ctx, alice, storage.Filter{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("PickRandom: got %v, want %v", err, context.Canceled)
+	}
+
+	if err := s.Remove(ctx, p); !errors.Is(err, context.Canceled) {
+		t.Errorf("Remove: got %v, want %v", err, context.Canceled)
+	}
+
+	if _, err := s.List(ctx, alice, storage.Filter{}, 0, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("List: got %v, want %v", err, context.Canceled)
+	}
+
+	assertExists(t, s, p, false)
+}
+
+// testOffsets checks that offsets start at zero, keep the last value set
+// and are stored separately for every name.
+func testOffsets(t *testing.T, s storage.OffsetStore) {
+	ctx := context.Background()
+
+	assertOffset := func(name string, want int) {
+		t.Helper()
+
+		got, err := s.Offset(ctx, name)
+		if err != nil {
+			t.Fatalf("Offset(%q): %v", name, err)
+		}
+
+		if got != want {
+			t.Errorf("Offset(%q) = %d, want %d", name, got, want)
+		}
+	}
+
+	assertOffset("updates", 0)
+
+	for _, offset := range []int{42, 43} {
+		if err := s.SetOffset(ctx, "updates", offset); err != nil {
+			t.Fatalf("SetOffset(%d): %v", offset, err)
+		}
+
+		assertOffset("updates", offset)
+	}
+
+	assertOffset("other", 0)
+}
+
+func testDeadLetters(t *testing.T, s storage.DeadLetterStore) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	letters := []*storage.DeadLetter{
+		{Payload: []byte("first"), Error: "boom", Attempts: 1, FailedAt: now, NextAttemptAt: now.Add(time.Hour)},
+		{Payload: []byte("second"), Error: "boom", Attempts: 1, FailedAt: now.Add(time.Second), NextAttemptAt: now.Add(time.Minute)},
+		{Payload: []byte("exhausted"), Error: "boom", Attempts: 9, FailedAt: now.Add(2 * time.Second)},
+	}
+
+	for _, d := range letters {
+		if err := s.AddDeadLetter(ctx, d); err != nil {
+			t.Fatalf("AddDeadLetter: %v", err)
+		}
+
+		if d.ID == "" {
+			t.Fatal("AddDeadLetter did not assign an ID")
+		}
+	}
+
+	assertPayloads := func(due time.Time, want ...string) {
+		t.Helper()
+
+		got, err := s.DeadLetters(ctx, due, 10)
+		if err != nil {
+			t.Fatalf("DeadLetters: %v", err)
+		}
+
+		var payloads []string
+		for _, d := range got {
+			payloads = append(payloads, string(d.Payload))
+		}
+
+		if !slices.Equal(payloads, want) {
+			t.Errorf("DeadLetters(%v) = %q, want %q", due, payloads, want)
+		}
+	}
+
+	assertPayloads(time.Time{}, "first", "second", "exhausted")
+	assertPayloads(now.Add(time.Minute), "second")
+	assertPayloads(now.Add(2*time.Hour), "second", "first")
+
+	second := letters[1]
+	second.Error = "still failing"
+	second.Attempts = 2
+	second.NextAttemptAt = time.Time{}
+
+	if err := s.UpdateDeadLetter(ctx, second); err != nil {
+		t.Fatalf("UpdateDeadLetter: %v", err)
+	}
+
+	got, err := s.DeadLetter(ctx, second.ID)
+	if err != nil {
+		t.Fatalf("DeadLetter: %v", err)
+	}
+
+	if got.Error != "still failing" || got.Attempts != 2 || !got.NextAttemptAt.IsZero() ||
+		string(got.Payload) != "second" || !got.FailedAt.Equal(second.FailedAt) {
+		t.Errorf("DeadLetter = %+v, want updated %+v", got, second)
+	}
+
+	assertPayloads(now.Add(2*time.Hour), "first")
+
+	if err := s.RemoveDeadLetter(ctx, letters[0].ID); err != nil {
+		t.Fatalf("RemoveDeadLetter: %v", err)
+	}
+
+	assertPayloads(time.Time{}, "second", "exhausted")
+
+	for _, id := range []string{letters[0].ID, "missing", "../x"} {
+		if err := s.RemoveDeadLetter(ctx, id); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+			t.Errorf("RemoveDeadLetter(%q) = %v, want ErrDeadLetterNotFound", id, err)
+		}
+
+		if _, err := s.DeadLetter(ctx, id); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+			t.Errorf("DeadLetter(%q) = %v, want ErrDeadLetterNotFound", id, err)
+		}
+	}
+
+	missing := &storage.DeadLetter{ID: letters[0].ID}
+	if err := s.UpdateDeadLetter(ctx, missing); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+		t.Errorf("UpdateDeadLetter(removed) = %v, want ErrDeadLetterNotFound", err)
+	}
+}
+
+// assertExists fails the test if Exists does not report want for p.
+func assertExists(t *testing.T, s storage.Storage, p *storage.Page, want bool) {
+	t.Helper()
+
+	got, err := s.Exists(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Exists: %v", err)
+	}
+
+	if got != want {
+		t.Fatalf("Exists(%s, %d) = %v, want %v", p.URL, p.UserID, got, want)
+	}
+}
+
+// page builds a page for the given URL and user.
+func page(url string, userID int64) *storage.Page {
+	return &storage.Page{URL: url, UserID: userID}
+}
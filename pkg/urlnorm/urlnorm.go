@@ -0,0 +1,142 @@
+// Package urlnorm canonicalizes URLs, so that links differing only in case,
+// default ports, fragments, tracking parameters or query order are recognized
+// as the same page.
+package urlnorm
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Rule rewrites a URL of the host it is registered for. It runs after the
+// generic normalization, on a URL with a lowercase scheme and host.
+type Rule func(u *url.URL)
+
+// Normalizer canonicalizes URLs using per-domain rules.
+type Normalizer struct {
+	rules map[string]Rule // Rules by lowercase host without a port
+}
+
+// trackingParams are query parameters added by ad and analytics tools that
+// do not change the page. Parameters starting with "utm_" are dropped too.
+var trackingParams = map[string]bool{
+	"fbclid": true,
+	"gclid":  true,
+}
+
+// defaultPorts maps schemes to the ports implied when none is given.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Default normalizes URLs with DefaultRules.
+var Default = New(DefaultRules())
+
+// New creates a Normalizer applying rules by host. Hosts are matched
+// case-insensitively and without the port.
+func New(rules map[string]Rule) *Normalizer {
+	n := &Normalizer{rules: make(map[string]Rule, len(rules))}
+
+	for host, rule := range rules {
+		n.rules[strings.ToLower(host)] = rule
+	}
+
+	return n
+}
+
+// DefaultRules returns the built-in per-domain rules: YouTube short,
+// mobile and www links are rewritten to youtube.com/watch.
+func DefaultRules() map[string]Rule {
+	return map[string]Rule{
+		"youtu.be":        youtuBe,
+		"www.youtube.com": youtubeHost,
+		"m.youtube.com":   youtubeHost,
+	}
+}
+
+// Normalize returns the canonical form of rawURL using Default.
+func Normalize(rawURL string) string {
+	return Default.Normalize(rawURL)
+}
+
+// Normalize returns the canonical form of rawURL: the scheme and host are
+// lowercased, default ports, the fragment and tracking parameters are dropped,
+// query parameters are sorted by key and the rule of the host is applied.
+// Only absolute http(s) URLs are changed; anything else, including URLs
+// that cannot be parsed, is returned as is.
+func (n *Normalizer) Normalize(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	port, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return rawURL
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	if u.Port() == port {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	u.Host = strings.TrimSuffix(u.Host, ":")
+
+	u.Fragment, u.RawFragment = "", ""
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	if u.RawQuery != "" {
+		if q, err := url.ParseQuery(u.RawQuery); err == nil {
+			for key := range q {
+				if isTracking(key) {
+					delete(q, key)
+				}
+			}
+
+			// Encode sorts the parameters by key.
+			u.RawQuery = q.Encode()
+		}
+	}
+
+	u.ForceQuery = false
+
+	if rule, ok := n.rules[u.Hostname()]; ok {
+		rule(u)
+	}
+
+	return u.String()
+}
+
+// isTracking reports whether the query parameter key only serves tracking.
+func isTracking(key string) bool {
+	key = strings.ToLower(key)
+
+	return trackingParams[key] || strings.HasPrefix(key, "utm_")
+}
+
+// youtuBe rewrites youtu.be/<id> to youtube.com/watch?v=<id>,
+// keeping the other parameters such as the start time.
+func youtuBe(u *url.URL) {
+	id := strings.Trim(u.Path, "/")
+	if id == "" || strings.Contains(id, "/") {
+		return
+	}
+
+	q := u.Query()
+	q.Set("v", id)
+
+	u.Host = "youtube.com"
+	u.Path = "/watch"
+	u.RawPath = ""
+	u.RawQuery = q.Encode()
+}
+
+// youtubeHost moves www and mobile YouTube links to youtube.com.
+func youtubeHost(u *url.URL) {
+	u.Host = "youtube.com"
+}
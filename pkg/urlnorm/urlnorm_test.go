@@ -0,0 +1,51 @@
+package urlnorm
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"case and fragment", "HTTPS://Example.COM/Path#frag", "https://example.com/Path"},
+		{"tracking params", "https://example.com/a?utm_source=x&UTM_Medium=y&fbclid=1&gclid=2", "https://example.com/a"},
+		{"sorted query", "https://example.com/a?b=2&a=1&utm_campaign=z", "https://example.com/a?a=1&b=2"},
+		{"default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"default http port", "http://example.com:80/a", "http://example.com/a"},
+		{"other port kept", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"ipv6 default port", "https://[::1]:443/a", "https://[::1]/a"},
+		{"empty path", "https://example.com", "https://example.com/"},
+		{"empty query", "https://example.com/a?", "https://example.com/a"},
+		{"youtu.be", "https://youtu.be/dQw4w9WgXcQ?t=42&si=abc#x", "https://youtube.com/watch?si=abc&t=42&v=dQw4w9WgXcQ"},
+		{"mobile youtube", "https://m.youtube.com/watch?v=dQw4w9WgXcQ", "https://youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"other scheme", "mailto:Alice@Example.com", "mailto:Alice@Example.com"},
+		{"relative", "example.com/a#b", "example.com/a#b"},
+		{"unparsable", "https://exa mple.com/%zz", "https://exa mple.com/%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizerRules(t *testing.T) {
+	n := New(map[string]Rule{
+		"Example.com": func(u *url.URL) { u.Path = "/canonical" },
+	})
+
+	if got, want := n.Normalize("https://EXAMPLE.com:443/other"), "https://example.com/canonical"; got != want {
+		t.Errorf("Normalize = %q, want %q", got, want)
+	}
+
+	if got, want := n.Normalize("https://youtu.be/abc"), "https://youtu.be/abc"; got != want {
+		t.Errorf("Normalize without default rules = %q, want %q", got, want)
+	}
+}
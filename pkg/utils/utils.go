@@ -1,10 +0,0 @@
-package utils
-
-import "os"
-
-func envOrDefault(key, def string) string {
-	if v, ok := os.LookupEnv(key); ok && v != "" {
-		return v
-	}
-	return def
-}